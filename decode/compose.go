@@ -0,0 +1,166 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iancoleman/strcase"
+)
+
+// AllOf holds the components of an object composed with allOf. Each component is a pointer to a struct, and the whole
+// object is decoded into every one of them. Types known ahead of time can embed their components instead, as
+// embedded structs are decoded the same way
+type AllOf []interface{}
+
+// AnyOf holds the candidates of an object composed with anyOf. The object is decoded into every candidate it
+// matches, which are the ones kept. A candidate matches if it has a field for some property of the object, and
+// decoding the object into it in strict mode, where values of the wrong JSON type and every failed check are errors,
+// succeeds. Properties which are not fields of a candidate are ignored
+type AnyOf []interface{}
+
+// AllOfFactory returns a OneOfFactory making an AllOf of the objects made by ctors
+func AllOfFactory(ctors ...func() interface{}) OneOfFactory {
+	return func(map[string]interface{}) (interface{}, error) {
+		a := make(AllOf, len(ctors))
+		for i, ctor := range ctors {
+			a[i] = ctor()
+		}
+		return &a, nil
+	}
+}
+
+// AnyOfFactory returns a OneOfFactory making an AnyOf of the objects made by ctors
+func AnyOfFactory(ctors ...func() interface{}) OneOfFactory {
+	return func(map[string]interface{}) (interface{}, error) {
+		a := make(AnyOf, len(ctors))
+		for i, ctor := range ctors {
+			a[i] = ctor()
+		}
+		return &a, nil
+	}
+}
+
+// isComponent tells if a field is a struct embedded as an allOf component
+func isComponent(sf reflect.StructField) bool {
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return sf.Anonymous && sf.PkgPath == "" && t.Kind() == reflect.Struct
+}
+
+// decodeComponent decodes the whole object m into the embedded struct field. The properties of the other
+// components are not unknown to it, and its OneOf fields are looked up under objSchemaName, the schema name of the
+// object embedding it
+func (d *decoder) decodeComponent(m map[string]interface{}, field reflect.Value, path string, objSchemaName string) error {
+	rejectUnknown := d.rejectUnknown
+	d.rejectUnknown = false
+	defer func() { d.rejectUnknown = rejectUnknown }()
+
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		d.schemaName = objSchemaName
+		_, err := d.decodeInto(m, field.Interface(), path)
+		return err
+	}
+	d.schemaName = objSchemaName
+	_, err := d.decodeInto(m, field.Addr().Interface(), path)
+	return err
+}
+
+// promotedField returns the field of the struct v at index, which goes through the embedded structs the field is
+// promoted from. Nil embedded struct pointers on the way are allocated, unless they are unexported and cannot be set
+func promotedField(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set a field promoted from the nil unexported embedded %s", v.Type())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func (d *decoder) decodeAllOf(m map[string]interface{}, a AllOf, path string) error {
+	rejectUnknown := d.rejectUnknown
+	d.rejectUnknown = false
+	defer func() { d.rejectUnknown = rejectUnknown }()
+
+	for _, c := range a {
+		if _, err := d.decodeInto(m, c, path); err != nil {
+			if err = d.fail(path, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeAnyOf(m map[string]interface{}, a *AnyOf, path string) error {
+	ie := &InferenceError{Path: path, Rejected: map[string]error{}}
+	var matches AnyOf
+	for _, c := range *a {
+		name := typeName(c)
+		if !hasAnyField(c, m) {
+			ie.Rejected[name] = fmt.Errorf("no property of the object is a field of %s", name)
+			continue
+		}
+		// try a scratch object first, so that c is only decoded into once it is known to match
+		t := &decoder{pf: d.pf, collect: true, strict: true}
+		_, err := t.decodeInto(m, reflect.New(reflect.TypeOf(c).Elem()).Interface(), path)
+		if err == nil {
+			err = t.errs.errOrNil()
+		}
+		if err != nil {
+			ie.Rejected[name] = err
+			continue
+		}
+		if _, err = d.decodeInto(m, c, path); err != nil {
+			return err
+		}
+		ie.Matched = append(ie.Matched, name)
+		matches = append(matches, c)
+	}
+	if len(matches) == 0 {
+		return ie
+	}
+	*a = matches
+	return nil
+}
+
+// hasAnyField tells if some property of m is a field of the struct o points to
+func hasAnyField(o interface{}, m map[string]interface{}) bool {
+	t := reflect.TypeOf(o)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	for k := range m {
+		if _, ok := t.Elem().FieldByName(strcase.ToCamel(k)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the name of the type of o, or of the type it points to
+func typeName(o interface{}) string {
+	t := reflect.TypeOf(o)
+	if t == nil {
+		return "nil"
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
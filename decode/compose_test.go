@@ -0,0 +1,201 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+type Named struct {
+	Name *string `json:"name" required:"true"`
+}
+
+type Aged struct {
+	Age *int `json:"age" default:"1"`
+}
+
+type Licensed struct {
+	License *string `json:"license" minLength:"4"`
+}
+
+// ComposedPet is allOf Named, Aged and Licensed
+type ComposedPet struct {
+	Named
+	*Aged
+	Licensed
+	Kind *string `json:"kind"`
+}
+
+func composedPF(path string) (func(map[string]interface{}) (interface{}, error), error) {
+	switch path {
+	case "Composition.all":
+		return decode.AllOfFactory(func() interface{} { return &Named{} }, func() interface{} { return &Aged{} }), nil
+	case "Composition.any":
+		return decode.AnyOfFactory(NewHouse, NewShack, func() interface{} { return &Named{} }), nil
+	}
+	return nil, nil
+}
+
+type Composition struct {
+	All interface{} `json:"all"`
+	Any interface{} `json:"any"`
+}
+
+// position is embedded unexported, so it is not a component but its fields are promoted
+type position struct {
+	X int `json:"x"`
+}
+
+type Positioned struct {
+	position
+	Y int `json:"y"`
+}
+
+type PointerPositioned struct {
+	*position
+	Y int `json:"y"`
+}
+
+type Coordinates struct {
+	X int `json:"x"`
+}
+
+// located is unexported, but the Coordinates pointer it embeds can be set
+type located struct {
+	*Coordinates
+}
+
+type Located struct {
+	located
+}
+
+type BaseOwner struct {
+	Favorite interface{} `json:"favorite"`
+}
+
+// WrappedOwner is allOf BaseOwner, whose OneOf fields are looked up as fields of WrappedOwner
+type WrappedOwner struct {
+	BaseOwner
+	Name *string `json:"name"`
+}
+
+func wrappedPF(path string) (func(map[string]interface{}) (interface{}, error), error) {
+	if path == "WrappedOwner.favorite" {
+		return PetOwner_favorite_Factory, nil
+	}
+	return nil, nil
+}
+
+func TestAllOf(t *testing.T) {
+	Convey("Embedded structs are decoded from the whole object", t, func() {
+		p := &ComposedPet{}
+		_, err := decode.UnmarshalJSONIntoWithDefaults([]byte(`{ "name": "rex", "kind": "dog", "license": "L-123" }`), p, nil, true)
+		So(err, ShouldBeNil)
+		So(*p.Name, ShouldEqual, "rex")
+		So(*p.Kind, ShouldEqual, "dog")
+		So(*p.License, ShouldEqual, "L-123")
+		So(p.Aged, ShouldNotBeNil)
+		So(*p.Age, ShouldEqual, 1)
+	})
+
+	Convey("Fields promoted from unexported embedded structs are decoded", t, func() {
+		r, err := decode.DecodeInto(map[string]interface{}{"x": 5.0, "y": 6.0}, &Positioned{}, nil)
+		So(err, ShouldBeNil)
+		So(r.(*Positioned).X, ShouldEqual, 5)
+		So(r.(*Positioned).Y, ShouldEqual, 6)
+	})
+
+	Convey("Fields promoted from nil unexported embedded pointers are reported", t, func() {
+		r, err := decode.DecodeInto(map[string]interface{}{"x": 5.0, "y": 6.0}, &PointerPositioned{}, nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "nil unexported embedded *decode_test.position")
+		So(r, ShouldBeNil)
+
+		r, err = decode.DecodeInto(map[string]interface{}{"x": 5.0, "y": 6.0}, &PointerPositioned{position: &position{}}, nil)
+		So(err, ShouldBeNil)
+		So(r.(*PointerPositioned).X, ShouldEqual, 5)
+		So(r.(*PointerPositioned).Y, ShouldEqual, 6)
+
+		err = decode.Validate([]byte(`{ "x": 5, "y": 6 }`), &PointerPositioned{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"x"})
+	})
+
+	Convey("Nil embedded pointers which can be set are allocated", t, func() {
+		r, err := decode.DecodeInto(map[string]interface{}{"x": 5.0}, &Located{}, nil)
+		So(err, ShouldBeNil)
+		So(r.(*Located).X, ShouldEqual, 5)
+	})
+
+	Convey("OneOf fields of components are looked up under the embedding object", t, func() {
+		r, err := decode.UnmarshalJSONInto([]byte(`{ "name": "amy", "favorite": { "type": "Cat", "mood": "calm" } }`),
+			&WrappedOwner{}, wrappedPF)
+		So(err, ShouldBeNil)
+		o := r.(*WrappedOwner)
+		So(*o.Name, ShouldEqual, "amy")
+		So(o.Favorite, ShouldHaveSameTypeAs, &Cat{})
+		So(*o.Favorite.(*Cat).Mood, ShouldEqual, "calm")
+	})
+
+	Convey("The checks of every component apply", t, func() {
+		err := decode.Validate([]byte(`{ "age": 3, "license": "L" }`), &ComposedPet{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"name", "license"})
+	})
+
+	Convey("Properties of components are known in strict mode", t, func() {
+		f := decode.InferFactory("Composition.all", nil, func() interface{} { return &ComposedPet{} })
+		_, err := f(map[string]interface{}{"name": "rex", "age": 2.0})
+		So(err, ShouldBeNil)
+		_, err = f(map[string]interface{}{"name": "rex", "color": "red"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("AllOfFactory decodes the object into every component", t, func() {
+		e := &Composition{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "all": { "name": "rex", "age": 4 } }`), e, composedPF)
+		So(err, ShouldBeNil)
+		a, ok := e.All.(*decode.AllOf)
+		So(ok, ShouldBeTrue)
+		So(*(*a)[0].(*Named).Name, ShouldEqual, "rex")
+		So(*(*a)[1].(*Aged).Age, ShouldEqual, 4)
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "all": { "age": 4 } }`), e, composedPF)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAnyOf(t *testing.T) {
+	Convey("AnyOf keeps every candidate the object matches", t, func() {
+		e := &Composition{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "any": { "name": "hut", "rooms": 1 } }`), e, composedPF)
+		So(err, ShouldBeNil)
+		a := *e.Any.(*decode.AnyOf)
+		So(a, ShouldHaveLength, 3)
+		So(*a[0].(*House).Rooms, ShouldEqual, 1)
+		So(*a[1].(*Shack).Name, ShouldEqual, "hut")
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "any": { "material": "tin" } }`), e, composedPF)
+		So(err, ShouldBeNil)
+		a = *e.Any.(*decode.AnyOf)
+		So(a, ShouldHaveLength, 1)
+		So(a[0], ShouldHaveSameTypeAs, &Shack{})
+	})
+
+	Convey("AnyOf reports why every candidate was rejected", t, func() {
+		e := &Composition{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "any": { "name": 3 } }`), e, composedPF)
+		So(err, ShouldNotBeNil)
+		ie, ok := err.(*decode.InferenceError)
+		So(ok, ShouldBeTrue)
+		So(ie.Path, ShouldEqual, "any")
+		So(ie.Rejected, ShouldHaveLength, 3)
+		So(ie.Rejected["House"], ShouldNotBeNil)
+
+		err = decode.Validate([]byte(`{ "any": { "name": 3 } }`), &Composition{}, composedPF)
+		So(errorPaths(err), ShouldResemble, []string{"any"})
+	})
+}
@@ -42,6 +42,16 @@ type StructWithDefaults struct {
 	SR SubRecord
 }
 
+type StructWithLiteralDefaults struct {
+	Tags   []string       `default:"[\"a\",\"b\"]"`
+	PTags  *[]string      `default:"[\"c\"]"`
+	Counts map[string]int `default:"{\"rooms\":3}"`
+	Owners []SubRecord    `default:"[{\"name\":\"Anne\"},{}]"`
+	Home   House          `default:"{\"name\":\"cottage\",\"rooms\":3}"`
+	PHome  *House         `default:"{\"name\":\"villa\"}"`
+	Class  interface{}    `json:"class" default:"{\"type\":\"House\",\"rooms\":3}"`
+}
+
 type SubRecord struct {
 	kind string
 	Name *string `default:"James"`
@@ -618,6 +628,83 @@ func TestDefaultValues(t *testing.T) {
 
 	})
 
+	literalSPF := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if path == "StructWithLiteralDefaults.class" {
+			return Accommodation_class_Factory, nil
+		}
+		return nil, nil
+	}
+	Convey("Setting JSON literal Defaults", t, func() {
+		swd := &StructWithLiteralDefaults{}
+		_, err := decode.DecodeIntoWithDefaults(map[string]interface{}{}, swd, literalSPF, true)
+		So(err, ShouldBeNil)
+
+		So(swd.Tags, ShouldResemble, []string{"a", "b"})
+		So(swd.PTags, ShouldResemble, &[]string{"c"})
+		So(swd.Counts, ShouldResemble, map[string]int{"rooms": 3})
+		anne, james := "Anne", "James"
+		So(swd.Owners, ShouldResemble, []SubRecord{{Name: &anne}, {Name: &james}})
+		cottage, villa, rooms, house := "cottage", "villa", 3, "House"
+		So(swd.Home, ShouldResemble, House{Name: &cottage, Rooms: &rooms})
+		So(swd.PHome, ShouldResemble, &House{Name: &villa})
+		So(swd.Class, ShouldResemble, &House{Type: &house, Rooms: &rooms})
+	})
+
+	Convey("JSON literal Defaults do not override the payload", t, func() {
+		swd := &StructWithLiteralDefaults{}
+		m := map[string]interface{}{
+			"tags":   []interface{}{"x"},
+			"counts": map[string]interface{}{"halls": 2},
+			"class":  map[string]interface{}{"type": "Shack"},
+		}
+		_, err := decode.DecodeIntoWithDefaults(m, swd, literalSPF, true)
+		So(err, ShouldBeNil)
+		So(swd.Tags, ShouldResemble, []string{"x"})
+		So(swd.Counts, ShouldResemble, map[string]int{"halls": 2})
+		shack := "Shack"
+		So(swd.Class, ShouldResemble, &Shack{Type: &shack})
+	})
+
+	Convey("JSON array Defaults of byte and rune slices hold their elements", t, func() {
+		type RS struct {
+			Runes  []int32 `default:"[1,2]"`
+			Bytes  []byte  `default:"[3, 4]"`
+			Text   []rune  `default:"ab"`
+			Binary []byte  `default:"cd"`
+		}
+		rs := &RS{}
+		_, err := decode.DecodeIntoWithDefaults(map[string]interface{}{}, rs, nil, true)
+		So(err, ShouldBeNil)
+		So(rs.Runes, ShouldResemble, []int32{1, 2})
+		So(rs.Bytes, ShouldResemble, []byte{3, 4})
+		So(rs.Text, ShouldResemble, []rune("ab"))
+		So(rs.Binary, ShouldResemble, []byte("cd"))
+	})
+
+	Convey("OneOf JSON literal Defaults require a factory", t, func() {
+		_, err := decode.DecodeIntoWithDefaults(map[string]interface{}{}, &StructWithLiteralDefaults{}, testSPF, true)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Bad JSON literal default values", t, func() {
+		type BL struct {
+			List []int `default:"[1,"`
+		}
+		type BLT struct {
+			List []int `default:"[\"a\"]"`
+		}
+		type BM struct {
+			Map map[int]string `default:"{\"1\":\"a\"}"`
+		}
+
+		_, err := decode.DecodeIntoWithDefaults(m, &BL{}, testSPF, true)
+		So(err, ShouldNotBeNil)
+		_, err = decode.DecodeIntoWithDefaults(m, &BLT{}, testSPF, true)
+		So(err, ShouldNotBeNil)
+		_, err = decode.DecodeIntoWithDefaults(m, &BM{}, testSPF, true)
+		So(err, ShouldNotBeNil)
+	})
+
 	Convey("Bad default values", t, func() {
 		type BIS struct {
 			BadIntStr int `default:"aaaa"`
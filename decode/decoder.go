@@ -7,8 +7,11 @@ package decode
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/iancoleman/strcase"
 )
@@ -25,6 +28,72 @@ type PathFactory func(path string) (func(map[string]interface{}) (interface{}, e
 // DefaultTagName specifies the struct tag used to identify default value for the field
 const DefaultTagName = "default"
 
+// Defaulter is implemented by types that compute some of their defaults themselves, for example from other fields
+type Defaulter interface {
+	SetDefaults()
+}
+
+// DefaulterMode selects when SetDefaults is called on objects implementing Defaulter
+type DefaulterMode int
+
+const (
+	// DefaultersAfter calls SetDefaults once the object's fields have been decoded and set from their default tags
+	DefaultersAfter DefaulterMode = iota
+	// DefaultersBefore calls SetDefaults before the object's fields are decoded, so the payload overrides it
+	DefaultersBefore
+	// DefaultersBeforeAndAfter calls SetDefaults both before and after the object's fields are decoded
+	DefaultersBeforeAndAfter
+	// DefaultersOff never calls SetDefaults
+	DefaultersOff
+)
+
+// Options controls the optional behaviour of DecodeIntoWithOptions and ApplyDefaultsWithOptions
+type Options struct {
+	// ApplyDefaults sets the fields missing from the payload from their default tags and calls Defaulters
+	ApplyDefaults bool
+	// Defaulters selects when SetDefaults is called if defaults are applied
+	Defaulters DefaulterMode
+	// DefaultTags names the struct tags holding default values, in order of preference, so that a profile such as
+	// {"default_dev", "default"} falls back to the plain default tag. DefaultTagName is used if it is empty
+	DefaultTags []string
+	// Tagging selects how the objects of OneOf fields are represented, by the field's path as passed to the
+	// PathFactory, such as "PetOwner.favorite". Fields not listed are internally tagged
+	Tagging map[string]Tagging
+	// UnknownFallback decodes the objects of OneOf fields whose factory returns an UnknownDiscriminatorError, or the
+	// error of a generated factory for an unknown discriminator value, into an Unknown rather than failing, so that types added by newer versions of an API do not break older clients
+	UnknownFallback bool
+	// Diagnostics is called with the problems which do not stop decoding, such as objects decoded into an Unknown,
+	// and the path where they are found
+	Diagnostics func(path string, err error)
+	// VerifyDiscriminators checks that the constructor of every Discriminated OneOf object sets its discriminator to
+	// the payload's value, or to the value it is mapped to by DiscriminatorMappings, which is then the value of the
+	// decoded object's discriminator field
+	VerifyDiscriminators bool
+	// DiscriminatorMappings maps payload discriminator values to the values set by constructors, by OneOf field path,
+	// such as {"Cat.sound": {"LOUD": "MEOW"}}
+	DiscriminatorMappings map[string]map[string]string
+}
+
+// decoder holds the state shared by the whole tree of objects decoded by a single call
+type decoder struct {
+	pf   PathFactory
+	opts Options
+	// errs collects the problems which do not stop decoding, such as missing required properties
+	errs Errors
+	// collect makes every error be collected in errs, so that decoding goes on with the rest of the payload
+	collect bool
+	// strict rejects values whose JSON type does not match their field's type
+	strict bool
+	// rejectUnknown rejects properties which are not fields of their object
+	rejectUnknown bool
+	// schemaName overrides the schema name of the next object decoded, so that components are decoded under the
+	// name of the object embedding them
+	schemaName string
+	// interfaceOneOfs only asks the PathFactory for the factories of interface fields, for PathFactories which have
+	// one for every path
+	interfaceOneOfs bool
+}
+
 // UnmarshalJSON byte description of a Decodeable thing
 func UnmarshalJSON(b []byte, discriminator string, f Factory) (interface{}, error) {
 	m := make(map[string]interface{})
@@ -35,39 +104,125 @@ func UnmarshalJSON(b []byte, discriminator string, f Factory) (interface{}, erro
 	return Decode(m, discriminator, f)
 }
 
-// UnmarshalJSON byte into an instance of object
+// UnmarshalJSON byte into an instance of object, or into the object made for a RootPath
 func UnmarshalJSONInto(b []byte, o interface{}, pf PathFactory) (interface{}, error) {
 	return UnmarshalJSONIntoWithDefaults(b, o, pf, false)
 }
 
 // UnmarshalJSON byte into an instance of object
 func UnmarshalJSONIntoWithDefaults(b []byte, o interface{}, pf PathFactory, applyDefaults bool) (interface{}, error) {
+	return UnmarshalJSONIntoWithOptions(b, o, pf, Options{ApplyDefaults: applyDefaults})
+}
+
+// UnmarshalJSON byte into an instance of object
+func UnmarshalJSONIntoWithOptions(b []byte, o interface{}, pf PathFactory, opts Options) (interface{}, error) {
 	m := make(map[string]interface{})
 	err := json.Unmarshal(b, &m)
 	if err != nil {
 		return nil, err
 	}
-	return decodeInto(m, o, pf, applyDefaults)
+	return DecodeIntoWithOptions(m, o, pf, opts)
 }
 
 // Decode a map into a Decodeable thing given the discriminator and the factory for all possible
-// types and embedded types
+// types and embedded types. Objects which do not have the discriminator property, or all objects if it is empty,
+// are identified by the property named by the Discriminator method of the type its value makes. Number and boolean
+// discriminators are passed to f as strings, such as "3" for both 3 and 3.0, or "true". The discriminator may be a
+// JSON pointer such as "/meta/kind" for objects holding it in a nested object, which is then decoded as a plain object
+// without the discriminator, and checked like the objects of DecodeInto
 func Decode(m map[string]interface{}, discriminator string, f Factory) (interface{}, error) {
-	kind, ok := m[discriminator].(string)
-	if !ok {
-		return nil, fmt.Errorf("could not find value for discriminator %s in map %#v", discriminator, m)
+	return decodeKinds(m, singleKind(discriminator, f, nil))
+}
+
+// DecodeWithMatching is Decode matching discriminator values as described by mt, and setting the discriminator field
+// of every object to its canonical value
+func DecodeWithMatching(m map[string]interface{}, discriminator string, f Factory, mt Matching) (interface{}, error) {
+	return decodeKinds(m, singleKind(discriminator, f, &mt))
+}
+
+// DecodeCompound is Decode for objects identified by several discriminator properties, such as a type and a schema
+// version. f is called with the CompoundKind of their values, in the order of discriminators
+func DecodeCompound(m map[string]interface{}, discriminators []string, f Factory) (interface{}, error) {
+	return decodeKinds(m, func(m map[string]interface{}) (interface{}, []string, error) {
+		kind, err := compoundKind(m, discriminators)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, err := f(kind)
+		return r, discriminators, err
+	})
+}
+
+// kindResolver makes the object described by m, and returns it with the discriminator properties identifying it
+type kindResolver func(m map[string]interface{}) (interface{}, []string, error)
+
+// singleKind resolves objects identified by a single discriminator property, as described by Decode
+func singleKind(discriminator string, f Factory, mt *Matching) kindResolver {
+	return func(m map[string]interface{}) (interface{}, []string, error) {
+		r, dk, err := resolveKind(m, discriminator, func(_, kind string) (interface{}, error) {
+			if mt != nil {
+				kind = mt.kind(kind)
+			}
+			return f(kind)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if mt != nil {
+			dp, _ := lookupDiscriminator(m, dk)
+			kind, _ := discriminatorValue(dp)
+			setDiscriminatorField(r, dk, mt.kind(kind))
+		}
+		return r, []string{dk}, nil
+	}
+}
+
+// decodeKinds decodes m into the objects made by resolve. The problems which do not stop decoding, such as missing
+// required properties of objects holding a nested discriminator, are returned once all of m is decoded
+func decodeKinds(m map[string]interface{}, resolve kindResolver) (interface{}, error) {
+	d := &decoder{}
+	r, err := d.decodeKind(m, resolve)
+	if err != nil {
+		return nil, err
 	}
-	r, err := f(kind)
+	return r, d.errs.errOrNil()
+}
+
+func (d *decoder) decodeKind(m map[string]interface{}, resolve kindResolver) (interface{}, error) {
+	r, dks, err := resolve(m)
 	if err != nil {
 		return nil, err
 	}
+	skip := make(map[string]bool, len(dks))
+	plain := map[string]bool{}
+	for _, dk := range dks {
+		tokens, ok := pointerTokens(dk)
+		if !ok {
+			skip[dk] = true
+			continue
+		}
+		// only the leaf of a nested discriminator is skipped, the objects holding it are not OneOf objects
+		m = withoutPointer(m, tokens).(map[string]interface{})
+		plain[tokens[0]] = true
+	}
 	for k, v := range m {
-		if k == discriminator {
+		if skip[k] {
+			continue
+		}
+		if plain[k] {
+			fldName := strcase.ToCamel(k)
+			field := reflect.ValueOf(r).Elem().FieldByName(fldName)
+			if !field.IsValid() {
+				continue
+			}
+			if err := d.decodeField(field, k, fldName, typeName(r), k, v); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		obj, ok := v.(map[string]interface{})
 		if ok {
-			child, err := Decode(obj, discriminator, f)
+			child, err := d.decodeKind(obj, resolve)
 			if err != nil {
 				return nil, err
 			}
@@ -79,7 +234,7 @@ func Decode(m map[string]interface{}, discriminator string, f Factory) (interfac
 			s := reflect.MakeSlice(elemType, len(obj), len(obj))
 			for i := range obj {
 				if objm, ok := obj[i].(map[string]interface{}); ok {
-					child2, err := Decode(objm, discriminator, f)
+					child2, err := d.decodeKind(objm, resolve)
 					if err != nil {
 						return nil, err
 					}
@@ -95,7 +250,7 @@ func Decode(m map[string]interface{}, discriminator string, f Factory) (interfac
 			elemType := reflect.ValueOf(r).Elem().FieldByName(strcase.ToCamel(k)).Type()
 			s := reflect.MakeSlice(elemType, len(obj), len(obj))
 			for i := range obj {
-				child2, err := Decode(obj[i], discriminator, f)
+				child2, err := d.decodeKind(obj[i], resolve)
 				if err != nil {
 					return nil, err
 				}
@@ -129,16 +284,84 @@ func Decode(m map[string]interface{}, discriminator string, f Factory) (interfac
 	return r, nil
 }
 
+// resolveKind makes the object described by m and returns it with its discriminator property. f is called with the
+// name of the discriminator property and its value
+func resolveKind(m map[string]interface{}, discriminator string, f func(dk, kind string) (interface{}, error)) (interface{}, string, error) {
+	dp, _ := lookupDiscriminator(m, discriminator)
+	if kind, ok := discriminatorValue(dp); ok {
+		r, err := f(discriminator, kind)
+		return r, discriminator, err
+	}
+
+	// look for the one property whose value makes an object which names that property as its discriminator
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var r interface{}
+	var found []string
+	for _, k := range keys {
+		kind, ok := discriminatorValue(m[k])
+		if !ok {
+			continue
+		}
+		c, err := f(k, kind)
+		if err != nil {
+			continue
+		}
+		if dc, ok := c.(Discriminated); ok && dc.Discriminator() == k {
+			r = c
+			found = append(found, k)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, "", fmt.Errorf("could not find value for discriminator %s in map %#v", discriminator, m)
+	case 1:
+		return r, found[0], nil
+	}
+	return nil, "", fmt.Errorf("ambiguous discriminator in map %#v, could be any of %v", m, found)
+}
+
+// DecodeInto decodes m into the object o, or into the object made by the factory of a RootPath, which is returned
 func DecodeInto(m map[string]interface{}, o interface{}, pf PathFactory) (interface{}, error) {
-	return decodeInto(m, o, pf, false)
+	return DecodeIntoWithOptions(m, o, pf, Options{})
 }
 
 func DecodeIntoWithDefaults(m map[string]interface{}, o interface{}, pf PathFactory, applyDefaults bool) (interface{}, error) {
-	return decodeInto(m, o, pf, applyDefaults)
+	return DecodeIntoWithOptions(m, o, pf, Options{ApplyDefaults: applyDefaults})
+}
+
+// DecodeIntoWithOptions decodes m into o like DecodeInto, with the optional behaviour described by opts
+func DecodeIntoWithOptions(m map[string]interface{}, o interface{}, pf PathFactory, opts Options) (interface{}, error) {
+	d := &decoder{pf: pf, opts: opts}
+	var r interface{}
+	var err error
+	if rp, ok := o.(RootPath); ok {
+		r, err = d.decodeRoot(m, rp)
+	} else {
+		r, err = d.decodeInto(m, o, "")
+	}
+	if err != nil {
+		return r, err
+	}
+	return r, d.errs.errOrNil()
 }
 
 // Decode an object's attributes using PathFactory
-func decodeInto(m map[string]interface{}, o interface{}, pf PathFactory, applyDefaults bool) (interface{}, error) {
+func (d *decoder) decodeInto(m map[string]interface{}, o interface{}, path string) (interface{}, error) {
+	// components are decoded under the schema name of the object embedding them
+	schemaName := d.schemaName
+	d.schemaName = ""
+
+	switch c := o.(type) {
+	case *AllOf:
+		return o, d.decodeAllOf(m, *c, path)
+	case *AnyOf:
+		return o, d.decodeAnyOf(m, c, path)
+	}
+
 	vo := reflect.ValueOf(o)
 	to := vo.Type()
 	fm := map[string]reflect.StructField{}
@@ -149,96 +372,167 @@ func decodeInto(m map[string]interface{}, o interface{}, pf PathFactory, applyDe
 	}
 
 	objSchemaName := to.Elem().Name()
+	if schemaName != "" {
+		objSchemaName = schemaName
+	}
 
-	// only scan struct fields if applyDefaults is specified
-	if applyDefaults {
-		for i := 0; i < vo.Elem().NumField(); i++ {
-			sf := to.Elem().Field(i)
-			fm[sf.Name] = sf
+	if d.opts.ApplyDefaults && d.callDefaulter(DefaultersBefore) {
+		if df, ok := o.(Defaulter); ok {
+			df.SetDefaults()
 		}
 	}
-	// for each field in the map, if the field is a OneOf (as described in dd), use the associated factory
-	for k, v := range m {
 
-		fldName := strcase.ToCamel(k)
-		field := vo.Elem().FieldByName(fldName)
+	// only structs have fields to decode and check
+	isStruct := to.Elem().Kind() == reflect.Struct
 
-		// ignore unknown fields
-		if !field.IsValid() {
+	for i := 0; isStruct && i < vo.Elem().NumField(); i++ {
+		sf := to.Elem().Field(i)
+		fm[sf.Name] = sf
+	}
+
+	// embedded structs are allOf components, decoded from the whole object
+	for i := 0; isStruct && i < to.Elem().NumField(); i++ {
+		sf := to.Elem().Field(i)
+		if !isComponent(sf) {
 			continue
 		}
+		delete(fm, sf.Name)
+		if e := d.decodeComponent(m, vo.Elem().Field(i), path, objSchemaName); e != nil {
+			if e = d.fail(path, e); e != nil {
+				return nil, e
+			}
+		}
+	}
 
-		// remove from field set
-		delete(fm, fldName)
+	// for each field in the map, if the field is a OneOf (as described in dd), use the associated factory.
+	// Keys are handled in order so that errors are reported in the same order every time
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m[k]
 
-		// decode regular fields, recursing into decodeInto in case of object or array types
-		switch vt := v.(type) {
-		case map[string]interface{}:
-			// Decode a OneOf field and continue if it is
-			ok, e := decodeIntoOneOfField(field, fldName, objSchemaName, k, vt, pf, applyDefaults)
-			if e != nil {
-				return nil, e
+		fldName := strcase.ToCamel(k)
+		var field reflect.Value
+		if isStruct {
+			sf, ok := to.Elem().FieldByName(fldName)
+			// fields of components have been decoded already
+			if ok && (isComponent(sf) || len(sf.Index) > 1 && isComponent(to.Elem().Field(sf.Index[0]))) {
+				continue
 			}
-			if !ok {
-				if e := decodeIntoObjectField(field, fldName, vt, pf, applyDefaults); e != nil {
-					return nil, e
+			if ok {
+				var e error
+				if field, e = promotedField(vo.Elem(), sf.Index); e != nil {
+					if e = d.fail(joinPath(path, k), e); e != nil {
+						return nil, e
+					}
+					continue
 				}
 			}
+		}
 
-			continue
-
-		case []interface{}:
-			if e := decodeIntoArrayField(field, fldName, vt, pf, applyDefaults); e != nil {
-				return nil, e
+		// ignore unknown fields
+		if !field.IsValid() {
+			if d.rejectUnknown {
+				if e := d.fail(joinPath(path, k), fmt.Errorf("Unknown property '%s'", k)); e != nil {
+					return nil, e
+				}
 			}
 			continue
+		}
 
-		case []map[string]interface{}:
-			if e := decodeIntoArrayOfObjectsField(field, fldName, vt, pf, applyDefaults); e != nil {
+		// remove from field set
+		delete(fm, fldName)
+
+		if e := d.decodeField(field, joinPath(path, k), fldName, objSchemaName, k, v); e != nil {
+			if e = d.fail(joinPath(path, k), e); e != nil {
 				return nil, e
 			}
-			continue
-		case nil:
-			// if field is required, return an error, otherwise ignore it
-			if field.Kind() != reflect.Ptr {
-				return nil, fmt.Errorf("Invalid value: Null not allowed for required field '%v'\n", fldName)
-			}
-			continue
 		}
+	}
 
-		// use reflection to set the field
-		if field.Kind() == reflect.Ptr {
-			if e := assignPtrField(v, field, fldName); e != nil {
-				return nil, e
+	if isStruct {
+		d.checkRequired(m, to.Elem(), path)
+	}
+
+	if d.opts.ApplyDefaults {
+		if isStruct {
+			if err := d.setObjectDefaultValues(fm, vo, path); err != nil {
+				return o, err
 			}
-			continue
 		}
+		if df, ok := o.(Defaulter); ok && d.callDefaulter(DefaultersAfter) {
+			df.SetDefaults()
+		}
+	}
 
-		// special case for empty interfaces - they must represent objects hence we should not be here
-		if field.Type().Kind() == reflect.Interface && field.Type().NumMethod() == 0 {
-			return nil, fmt.Errorf("Invalid value found for field name %v (expected object, not basic type)\n", fldName)
+	if isStruct {
+		d.checkConstraints(vo, fm, path)
+		d.checkRules(m, vo, path)
+	}
+	d.validate(o, path)
+
+	return o, nil
+}
+
+// callDefaulter tells if SetDefaults should be called at the given stage of decoding an object
+func (d *decoder) callDefaulter(stage DefaulterMode) bool {
+	return d.opts.Defaulters == stage || d.opts.Defaulters == DefaultersBeforeAndAfter
+}
+
+// decodeField sets a single field from its payload value v, recursing into decodeInto in case of object or array types
+func (d *decoder) decodeField(field reflect.Value, path string, fldName string, objSchemaName string, k string, v interface{}) error {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		// Decode a OneOf field and return if it is
+		ok, e := d.decodeIntoOneOfField(field, path, fldName, objSchemaName, k, vt)
+		if e != nil || ok {
+			return e
 		}
+		return d.decodeIntoObjectField(field, path, fldName, objSchemaName, k, vt)
 
-		if field.CanInterface() {
-			newVal := reflect.TypeOf(field.Interface())
-			if newVal != reflect.TypeOf(v) {
-				if newVal != nil && reflect.TypeOf(v).ConvertibleTo(newVal) {
-					field.Set(reflect.ValueOf(v).Convert(newVal))
-					continue
-				} else {
-					return nil, fmt.Errorf("cannot convert value (%v) to field '%s's' type\n", v, fldName)
-				}
-			}
+	case []interface{}:
+		return d.decodeIntoArrayField(field, path, fldName, vt)
+
+	case []map[string]interface{}:
+		return d.decodeIntoArrayOfObjectsField(field, path, fldName, vt)
+
+	case nil:
+		// if field is required, return an error, otherwise ignore it
+		if field.Kind() != reflect.Ptr {
+			return fmt.Errorf("Invalid value: Null not allowed for required field '%v'\n", fldName)
 		}
-		field.Set(reflect.ValueOf(v))
+		return nil
 	}
 
-	var err error
-	if applyDefaults {
-		err = setObjectDefaultValues(fm, vo)
+	if d.strict && !strictlyAssignable(v, field.Type()) {
+		return fmt.Errorf("Value (%v) of type %T does not match the type of field '%s'\n", v, v, fldName)
 	}
 
-	return o, err
+	// use reflection to set the field
+	if field.Kind() == reflect.Ptr {
+		return assignPtrField(v, field, fldName)
+	}
+
+	// special case for empty interfaces - they must represent objects hence we should not be here
+	if field.Type().Kind() == reflect.Interface && field.Type().NumMethod() == 0 {
+		return fmt.Errorf("Invalid value found for field name %v (expected object, not basic type)\n", fldName)
+	}
+
+	if field.CanInterface() {
+		newVal := reflect.TypeOf(field.Interface())
+		if newVal != reflect.TypeOf(v) {
+			if newVal != nil && reflect.TypeOf(v).ConvertibleTo(newVal) {
+				field.Set(reflect.ValueOf(v).Convert(newVal))
+				return nil
+			}
+			return fmt.Errorf("cannot convert value (%v) to field '%s's' type\n", v, fldName)
+		}
+	}
+	field.Set(reflect.ValueOf(v))
+	return nil
 }
 
 func assignPtrField(v interface{}, field reflect.Value, fldName string) error {
@@ -255,7 +549,7 @@ func assignPtrField(v interface{}, field reflect.Value, fldName string) error {
 
 type iterator func() (next iterator, obj interface{})
 
-func decodeIntoArray(field reflect.Value, iter iterator, len int, pf PathFactory, applyDefaults bool) error {
+func (d *decoder) decodeIntoArray(field reflect.Value, path string, iter iterator, len int) error {
 	var s reflect.Value
 	var ps reflect.Value
 	var et reflect.Type
@@ -284,10 +578,28 @@ func decodeIntoArray(field reflect.Value, iter iterator, len int, pf PathFactory
 		objm, ok := o.(map[string]interface{})
 		if ok {
 			pV = reflect.New(et)
-			_, err := decodeInto(objm, pV.Interface(), pf, applyDefaults)
+			_, err := d.decodeInto(objm, pV.Interface(), indexPath(path, i))
 			if err != nil {
-				return err
+				if err = d.fail(indexPath(path, i), err); err != nil {
+					return err
+				}
+				i++
+				continue
+			}
+		} else if !pV.IsValid() {
+			// null elements are left as zero values
+			i++
+			continue
+		} else if pV.Type() != et {
+			if !pV.Type().ConvertibleTo(et) || d.strict && !strictlyAssignable(o, et) {
+				err := fmt.Errorf("cannot convert value (%v) to array element type %s\n", o, et)
+				if err = d.fail(indexPath(path, i), err); err != nil {
+					return err
+				}
+				i++
+				continue
 			}
+			pV = pV.Convert(et)
 		}
 
 		// If s is a slice of pointers and pV is not a pointer
@@ -315,7 +627,7 @@ func decodeIntoArray(field reflect.Value, iter iterator, len int, pf PathFactory
 	return nil
 }
 
-func decodeIntoArrayOfObjectsField(field reflect.Value, fldName string, obj []map[string]interface{}, pf PathFactory, applyDefaults bool) error {
+func (d *decoder) decodeIntoArrayOfObjectsField(field reflect.Value, path string, fldName string, obj []map[string]interface{}) error {
 	n := 0
 	var i iterator
 	i = func() (iterator, interface{}) {
@@ -326,10 +638,10 @@ func decodeIntoArrayOfObjectsField(field reflect.Value, fldName string, obj []ma
 		return nil, nil
 	}
 
-	return decodeIntoArray(field, i, len(obj), pf, applyDefaults)
+	return d.decodeIntoArray(field, path, i, len(obj))
 }
 
-func decodeIntoArrayField(field reflect.Value, fldName string, obj []interface{}, pf PathFactory, applyDefaults bool) error {
+func (d *decoder) decodeIntoArrayField(field reflect.Value, path string, fldName string, obj []interface{}) error {
 	n := 0
 	var i iterator
 	i = func() (iterator, interface{}) {
@@ -340,17 +652,20 @@ func decodeIntoArrayField(field reflect.Value, fldName string, obj []interface{}
 		return nil, nil
 	}
 
-	return decodeIntoArray(field, i, len(obj), pf, applyDefaults)
+	return d.decodeIntoArray(field, path, i, len(obj))
 }
 
-func decodeIntoObjectField(field reflect.Value, _ string, v map[string]interface{}, pf PathFactory, applyDefaults bool) error {
+func (d *decoder) decodeIntoObjectField(field reflect.Value, path string, fldName string, objSchemaName string, k string, v map[string]interface{}) error {
 	ft := field.Type()
 	if field.Type().Kind() == reflect.Ptr {
 		ft = ft.Elem()
 	}
+	if ft.Kind() == reflect.Map {
+		return d.decodeIntoMapField(field, path, fldName, objSchemaName, k, v)
+	}
 	pV := reflect.New(ft).Interface()
 
-	child, err := decodeInto(v, pV, pf, applyDefaults)
+	child, err := d.decodeInto(v, pV, path)
 	if err != nil {
 		return err
 	}
@@ -363,7 +678,85 @@ func decodeIntoObjectField(field reflect.Value, _ string, v map[string]interface
 	return nil
 }
 
-func decodeIntoOneOfField(field reflect.Value, _ string, objSchemaName string, k string, v map[string]interface{}, pf PathFactory, applyDefaults bool) (bool, error) {
+// decodeIntoMapField decodes each value of v into a new map. Values of a map are decoded like the field holding
+// the map, so OneOf values are resolved using the field's path
+func (d *decoder) decodeIntoMapField(field reflect.Value, path string, fldName string, objSchemaName string, k string, v map[string]interface{}) error {
+	ft := field.Type()
+	if field.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft.Key().Kind() != reflect.String {
+		return fmt.Errorf("cannot decode object into field '%s': map keys must be strings\n", fldName)
+	}
+
+	mv := reflect.MakeMapWithSize(ft, len(v))
+	et := ft.Elem()
+	keys := make([]string, 0, len(v))
+	for mk := range v {
+		keys = append(keys, mk)
+	}
+	sort.Strings(keys)
+	for _, mk := range keys {
+		mval := v[mk]
+		ev := reflect.New(et).Elem()
+		// values of maps of empty interfaces are kept as they are
+		if et.Kind() == reflect.Interface && et.NumMethod() == 0 {
+			if mval != nil {
+				ev.Set(reflect.ValueOf(mval))
+			}
+		} else if err := d.decodeField(ev, joinPath(path, mk), fmt.Sprintf("%s[%s]", fldName, mk), objSchemaName, k, mval); err != nil {
+			if err = d.fail(joinPath(path, mk), err); err != nil {
+				return err
+			}
+			continue
+		}
+		mv.SetMapIndex(reflect.ValueOf(mk).Convert(ft.Key()), ev)
+	}
+
+	if field.Kind() == reflect.Ptr {
+		mv = ptr(mv)
+	}
+	field.Set(mv)
+	return nil
+}
+
+// decodeOneOf makes the object v of the OneOf field pp, to be held in a value of type t, with the field's factory f
+// and decodes it
+func (d *decoder) decodeOneOf(f OneOfFactory, pp string, t reflect.Type, v map[string]interface{}, path string) (interface{}, error) {
+	raw := v
+	v, path, err := d.opts.Tagging[pp].untag(v, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// factories matching discriminator values write the canonical one back into the object they are given, which
+	// must not be the caller's
+	o := copyObject(v)
+	child, err := f(o)
+	if err != nil {
+		if u, ok := d.fallback(t, raw, v, path, err); ok {
+			return u, nil
+		}
+		return nil, err
+	}
+
+	var dk, dv string
+	if d.opts.VerifyDiscriminators {
+		if dk, dv, err = d.verifyDiscriminator(pp, o, child); err != nil {
+			return nil, err
+		}
+	}
+
+	if child, err = d.decodeInto(o, child, path); err != nil {
+		return nil, err
+	}
+	if dk != "" {
+		setDiscriminatorField(child, dk, dv)
+	}
+	return child, nil
+}
+
+func (d *decoder) decodeIntoOneOfField(field reflect.Value, path string, _ string, objSchemaName string, k string, v map[string]interface{}) (bool, error) {
 	var pp string
 	var f OneOfFactory
 	var child interface{}
@@ -371,16 +764,17 @@ func decodeIntoOneOfField(field reflect.Value, _ string, objSchemaName string, k
 
 	pp = fmt.Sprintf("%s.%s", objSchemaName, k)
 
-	// get a factory. If factory is nil, but no error, factory was not found for this field
-	if f, err = pf(pp); err != nil || f == nil {
-		return f != nil, err
+	// without a PathFactory there are no OneOf fields
+	if d.pf == nil || d.interfaceOneOfs && field.Kind() != reflect.Interface {
+		return false, nil
 	}
 
-	if child, err = f(v); err != nil {
-		return false, err
+	// get a factory. If factory is nil, but no error, factory was not found for this field
+	if f, err = d.pf(pp); err != nil || f == nil {
+		return f != nil, err
 	}
 
-	if child, err = decodeInto(v, child, pf, applyDefaults); err == nil {
+	if child, err = d.decodeOneOf(f, pp, field.Type(), v, path); err == nil {
 		field.Set(reflect.ValueOf(child))
 	}
 	return err == nil, err
@@ -413,21 +807,45 @@ func parseAndSetField(path string, field, newField, val reflect.Value) error {
 	return fmt.Errorf("cannot convert value (%v) to field '%s' type\n", val, path)
 }
 
-func setObjectDefaultValues(fm map[string]reflect.StructField, vo reflect.Value) error {
-	for k, v := range fm {
-		d, ok := v.Tag.Lookup(DefaultTagName)
+func (d *decoder) setObjectDefaultValues(fm map[string]reflect.StructField, vo reflect.Value, path string) error {
+	t := vo.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		v, ok := fm[t.Field(i).Name]
 		if !ok {
 			continue
 		}
-		if err := setFieldDefaultValue(vo, k, d); err != nil {
-			return err
+		dv, ok := d.lookupDefault(v)
+		if !ok {
+			continue
+		}
+		if err := d.setFieldDefaultValue(vo, v, dv, path); err != nil {
+			if err = d.fail(joinPath(path, fieldKey(v)), err); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func setFieldDefaultValue(vo reflect.Value, fn, dv string) (err error) {
+// lookupDefault returns the default value of a field from the first of the configured default tags it has
+func (d *decoder) lookupDefault(sf reflect.StructField) (string, bool) {
+	if len(d.opts.DefaultTags) == 0 {
+		return sf.Tag.Lookup(DefaultTagName)
+	}
+	for _, tn := range d.opts.DefaultTags {
+		if dv, ok := sf.Tag.Lookup(tn); ok {
+			return dv, true
+		}
+	}
+	return "", false
+}
+
+func (d *decoder) setFieldDefaultValue(vo reflect.Value, sf reflect.StructField, dv string, path string) (err error) {
 
+	fn := sf.Name
+	if dv, err = resolveDefault(dv); err != nil {
+		return fmt.Errorf("Cannot compute default value for field '%s': %s", fn, err)
+	}
 	f := vo.Elem().FieldByName(fn)
 	ft := f.Type()
 
@@ -442,12 +860,15 @@ func setFieldDefaultValue(vo reflect.Value, fn, dv string) (err error) {
 	// 1. types which reflect itself knows how to convert
 	// 2. types for which we have actual conversion from string
 	// 3. types for which Marshaller is defined and ban be used
-	if dV.Type().ConvertibleTo(ft) {
+	// 4. slices, maps, structs and OneOf interfaces described by a JSON literal
+	if dV.Type().ConvertibleTo(ft) && ft.Kind() != reflect.Interface && !(ft.Kind() == reflect.Slice && isJSONArray(dv)) {
 		cv = dV.Convert(ft)
 	} else if convertibleFromString(ft) {
 		cv, err = convertFromString(ft, dv)
 	} else if isUnmarshallableField(f) {
 		cv, err = convertUnmarshallerField(fn, f, dV)
+	} else if convertibleFromJSONLiteral(ft) {
+		return d.setFieldFromJSONLiteral(vo, sf, f, dv, path)
 	} else if unsupportedTypeForDefault(ft) {
 		err = fmt.Errorf("Field is not convertible: %s", fn)
 	}
@@ -514,6 +935,43 @@ func convertUnmarshallerField(path string, field, val reflect.Value) (vo reflect
 	return nV, nil
 }
 
+// strictlyAssignable tells if a payload value has the JSON type matching the type t it is decoded into: strings for
+// strings, integral numbers for integers, numbers for floats and booleans for bools. Types unmarshalling themselves
+// take any value
+func strictlyAssignable(v interface{}, t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return true
+	}
+	vv := reflect.ValueOf(v)
+	switch t.Kind() {
+	case reflect.String:
+		return vv.Kind() == reflect.String
+	case reflect.Bool:
+		return vv.Kind() == reflect.Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch vv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return vv.Float() == math.Trunc(vv.Float())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case reflect.Float32, reflect.Float64:
+		switch vv.Kind() {
+		case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
 func convertibleFromString(t reflect.Type) bool {
 	switch t.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -524,6 +982,41 @@ func convertibleFromString(t reflect.Type) bool {
 	return false
 }
 
+// isJSONArray tells if a default is a JSON array rather than a string, so that a default of []byte or []rune fields
+// such as "[1,2]" holds their elements rather than the characters of the tag
+func isJSONArray(dv string) bool {
+	return strings.HasPrefix(strings.TrimSpace(dv), "[") && json.Valid([]byte(dv))
+}
+
+func convertibleFromJSONLiteral(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Struct, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// setFieldFromJSONLiteral parses a default given as a JSON literal and decodes it into the field as if it had been
+// part of the payload, so that nested defaults and OneOf factories apply to it
+func (d *decoder) setFieldFromJSONLiteral(vo reflect.Value, sf reflect.StructField, f reflect.Value, dv string, path string) error {
+	var lit interface{}
+	if err := json.Unmarshal([]byte(dv), &lit); err != nil {
+		return fmt.Errorf("Cannot parse default value for field '%s' as JSON: %s", sf.Name, err)
+	}
+	k := fieldKey(sf)
+	return d.decodeField(f, joinPath(path, k), sf.Name, vo.Elem().Type().Name(), k, lit)
+}
+
+// fieldKey returns the payload key of a struct field, as named by its json tag if it has one
+func fieldKey(sf reflect.StructField) string {
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return strcase.ToLowerCamel(sf.Name)
+}
+
 func unsupportedTypeForDefault(t reflect.Type) bool {
 	switch t.Kind() {
 	case reflect.Uintptr, reflect.Complex64, reflect.Complex128, reflect.Array, reflect.Chan, reflect.Func,
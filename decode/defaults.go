@@ -0,0 +1,342 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProvider computes a default value at the time it is applied. The tag `default:"$name:arg"` calls the
+// provider registered as name with arg, and its result is converted to the field's type like a static default.
+// `default:"${VAR:-fallback}"` is shorthand for the env provider and a leading "$$" escapes a literal "$"
+type DefaultProvider func(arg string) (string, error)
+
+var providersLock sync.RWMutex
+
+var defaultProviders = map[string]DefaultProvider{
+	"now":      nowProvider,
+	"uuid":     uuidProvider,
+	"hostname": hostnameProvider,
+	"env":      envProvider,
+}
+
+// RegisterDefaultProvider makes p available to default tags as $name, replacing any provider of the same name
+func RegisterDefaultProvider(name string, p DefaultProvider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	defaultProviders[name] = p
+}
+
+func lookupDefaultProvider(name string) (DefaultProvider, bool) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	p, ok := defaultProviders[name]
+	return p, ok
+}
+
+// parseDefaultProvider splits a provider reference into the provider's name and argument. ok is false for static
+// defaults, in which case dv is returned with escapes removed
+func parseDefaultProvider(dv string) (name, arg string, ok bool) {
+	switch {
+	case !strings.HasPrefix(dv, "$"):
+		return "", dv, false
+	case strings.HasPrefix(dv, "$$"):
+		return "", dv[1:], false
+	case strings.HasPrefix(dv, "${") && strings.HasSuffix(dv, "}"):
+		return "env", dv[2 : len(dv)-1], true
+	}
+	name = dv[1:]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, arg = name[:i], name[i+1:]
+	}
+	return name, arg, true
+}
+
+// resolveDefault returns the value of a default tag, calling its provider if it references one
+func resolveDefault(dv string) (string, error) {
+	name, arg, ok := parseDefaultProvider(dv)
+	if !ok {
+		return arg, nil
+	}
+	p, ok := lookupDefaultProvider(name)
+	if !ok {
+		return "", fmt.Errorf("Unknown default provider '%s'", name)
+	}
+	return p(arg)
+}
+
+// nowProvider returns the current time, in RFC3339 format unless another layout is given
+func nowProvider(layout string) (string, error) {
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	return time.Now().UTC().Format(layout), nil
+}
+
+// uuidProvider returns a random (version 4) UUID
+func uuidProvider(_ string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func hostnameProvider(_ string) (string, error) {
+	return os.Hostname()
+}
+
+// envProvider returns the value of an environment variable, given as VAR or VAR:-fallback. As in a shell the
+// fallback is used when the variable is unset or empty
+func envProvider(arg string) (string, error) {
+	name, fallback, hasFallback := arg, "", false
+	if i := strings.Index(arg, ":-"); i >= 0 {
+		name, fallback, hasFallback = arg[:i], arg[i+2:], true
+	}
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		return v, nil
+	}
+	if !hasFallback {
+		return "", fmt.Errorf("Environment variable '%s' is not set", name)
+	}
+	return fallback, nil
+}
+
+// ApplyDefaults fills the zero valued fields of an already constructed object from their default tags. Pointers,
+// slices, maps and OneOf interface values are walked so that every nested object gets its defaults too
+func ApplyDefaults(o interface{}) error {
+	return ApplyDefaultsWithPathFactory(o, nil)
+}
+
+// ApplyDefaultsWithPathFactory is ApplyDefaults using pf to resolve OneOf fields whose default is a JSON literal
+func ApplyDefaultsWithPathFactory(o interface{}, pf PathFactory) error {
+	return ApplyDefaultsWithOptions(o, pf, Options{})
+}
+
+// ApplyDefaultsWithOptions is ApplyDefaultsWithPathFactory using the default tags and Defaulter mode of opts
+func ApplyDefaultsWithOptions(o interface{}, pf PathFactory, opts Options) error {
+	vo := reflect.ValueOf(o)
+	if vo.Kind() != reflect.Ptr || vo.IsNil() {
+		return fmt.Errorf("Target object is not a pointer. Unsupported")
+	}
+	opts.ApplyDefaults = true
+	d := &decoder{pf: pf, opts: opts}
+	if err := d.applyDefaults(vo, "", map[visit]bool{}); err != nil {
+		return err
+	}
+	return d.errs.errOrNil()
+}
+
+// visit identifies an object already walked by applyDefaults, so that cyclic structures terminate
+type visit struct {
+	ptr uintptr
+	t   reflect.Type
+}
+
+func (d *decoder) applyDefaults(v reflect.Value, path string, seen map[visit]bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		vk := visit{v.Pointer(), v.Type()}
+		if seen[vk] {
+			return nil
+		}
+		seen[vk] = true
+		return d.applyDefaults(v.Elem(), path, seen)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		e := v.Elem()
+		if e.Kind() == reflect.Ptr {
+			return d.applyDefaults(e, path, seen)
+		}
+		// values held by an interface are not addressable, work on a copy and put it back
+		if !v.CanSet() {
+			return nil
+		}
+		c := reflect.New(e.Type()).Elem()
+		c.Set(e)
+		if err := d.applyDefaults(c, path, seen); err != nil {
+			return err
+		}
+		v.Set(c)
+
+	case reflect.Struct:
+		return d.applyStructDefaults(v, path, seen)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.applyDefaults(v.Index(i), indexPath(path, i), seen); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		// map values are not addressable either
+		for _, k := range v.MapKeys() {
+			c := reflect.New(v.Type().Elem()).Elem()
+			c.Set(v.MapIndex(k))
+			if err := d.applyDefaults(c, joinPath(path, fmt.Sprint(k.Interface())), seen); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, c)
+		}
+	}
+	return nil
+}
+
+func (d *decoder) applyStructDefaults(v reflect.Value, path string, seen map[visit]bool) error {
+	if !v.CanAddr() {
+		return nil
+	}
+	df, isDefaulter := v.Addr().Interface().(Defaulter)
+	if isDefaulter && d.callDefaulter(DefaultersBefore) {
+		df.SetDefaults()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		// unexported fields cannot be set
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := v.Field(i)
+		if dv, ok := d.lookupDefault(sf); ok && isZeroValue(f) {
+			if err := d.setFieldDefaultValue(v.Addr(), sf, dv, path); err != nil {
+				return err
+			}
+		}
+		if err := d.applyDefaults(f, joinPath(path, fieldKey(sf)), seen); err != nil {
+			return err
+		}
+	}
+	if isDefaulter && d.callDefaulter(DefaultersAfter) {
+		df.SetDefaults()
+	}
+	return nil
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// CheckDefaults walks the struct types of the given objects and of everything they contain, and reports every default
+// tag which cannot be parsed for its field or is set on a field of an unsupported type. It is meant to be called from
+// init() or a unit test so that bad defaults are found without waiting for a payload which omits the field. Providers
+// are not called, only checked to be registered
+func CheckDefaults(types ...interface{}) error {
+	return CheckDefaultsWithOptions(nil, Options{}, types...)
+}
+
+// CheckDefaultsWithOptions is CheckDefaults checking every tag of opts.DefaultTags, and using pf to check the JSON
+// literal defaults of OneOf fields. Without a PathFactory these are only checked to be valid JSON
+func CheckDefaultsWithOptions(pf PathFactory, opts Options, types ...interface{}) error {
+	opts.ApplyDefaults = true
+	d := &decoder{pf: pf, opts: opts}
+	var errs Errors
+	seen := map[reflect.Type]bool{}
+	for _, o := range types {
+		t := reflect.TypeOf(o)
+		if t == nil {
+			continue
+		}
+		errs = d.checkTypeDefaults(t, "", seen, errs)
+	}
+	return errs.errOrNil()
+}
+
+func (d *decoder) checkTypeDefaults(t reflect.Type, path string, seen map[reflect.Type]bool, errs Errors) Errors {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return errs
+	}
+	seen[t] = true
+	if path == "" || t.Name() != "" {
+		path = t.Name()
+	}
+
+	tags := d.opts.DefaultTags
+	if len(tags) == 0 {
+		tags = []string{DefaultTagName}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fp := path + "." + sf.Name
+		for _, tn := range tags {
+			dv, ok := sf.Tag.Lookup(tn)
+			if !ok {
+				continue
+			}
+			if err := d.checkFieldDefault(t, sf, dv); err != nil {
+				errs = append(errs, &FieldError{Path: fp, Err: err})
+			}
+		}
+		errs = d.checkTypeDefaults(sf.Type, fp, seen, errs)
+	}
+	return errs
+}
+
+// checkProviderDefault checks a default referencing a provider without calling it, as its value may depend on the
+// environment of the check. Only the fallback of an environment variable, which is static, is set on a scratch object
+func (d *decoder) checkProviderDefault(t reflect.Type, sf reflect.StructField, name, arg string) error {
+	if _, ok := lookupDefaultProvider(name); !ok {
+		return fmt.Errorf("Unknown default provider '%s' for field '%s'", name, sf.Name)
+	}
+	if name != "env" {
+		return nil
+	}
+	i := strings.Index(arg, ":-")
+	if i < 0 {
+		i = len(arg)
+	}
+	if arg[:i] == "" {
+		return fmt.Errorf("Missing environment variable name in default value for field '%s'", sf.Name)
+	}
+	if i == len(arg) {
+		return nil
+	}
+	fallback := arg[i+2:]
+	if strings.HasPrefix(fallback, "$") {
+		fallback = "$" + fallback
+	}
+	return d.setFieldDefaultValue(reflect.New(t), sf, fallback, "")
+}
+
+// checkFieldDefault sets a default on a scratch object of type t
+func (d *decoder) checkFieldDefault(t reflect.Type, sf reflect.StructField, dv string) error {
+	if sf.PkgPath != "" {
+		return fmt.Errorf("Default value set on unexported field: %s", sf.Name)
+	}
+	if name, arg, ok := parseDefaultProvider(dv); ok {
+		return d.checkProviderDefault(t, sf, name, arg)
+	}
+	if sf.Type.Kind() == reflect.Interface && d.pf == nil {
+		if _, _, ok := parseDefaultProvider(dv); !ok && !json.Valid([]byte(dv)) {
+			return fmt.Errorf("Cannot parse default value for field '%s' as JSON", sf.Name)
+		}
+		return nil
+	}
+	// JSON literals are decoded like payloads, so they may also lack required properties
+	d.errs = nil
+	if err := d.setFieldDefaultValue(reflect.New(t), sf, dv, ""); err != nil {
+		return err
+	}
+	return d.errs.errOrNil()
+}
@@ -0,0 +1,397 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+type DefaultedRoom struct {
+	Name  *string `default:"hall"`
+	Doors int     `default:"2"`
+}
+
+type DefaultedHouse struct {
+	Name    string          `default:"home"`
+	Rooms   []DefaultedRoom `default:"[{}]"`
+	Wings   map[string]DefaultedRoom
+	Annexes map[string]*DefaultedRoom
+	Main    *DefaultedRoom
+	Class   interface{}
+	Next    *DefaultedHouse
+}
+
+func TestApplyDefaults(t *testing.T) {
+	hall := "hall"
+
+	Convey("Applying defaults to a constructed object", t, func() {
+		swd := &StructWithDefaults{Int: 3}
+		So(decode.ApplyDefaults(swd), ShouldBeNil)
+		So(swd.Int, ShouldEqual, 3)
+		So(swd.UInt, ShouldEqual, 12)
+		So(swd.Val, ShouldEqual, "STRING_VAL")
+		sp := "STRING_PTR"
+		So(swd.Ptr, ShouldResemble, &sp)
+		tm, _ := time.Parse(time.RFC3339, "2019-10-28T12:35:56Z")
+		So(swd.Time, ShouldEqual, tm)
+		// nested structs are walked even without a payload
+		james := "James"
+		So(swd.SR.Name, ShouldResemble, &james)
+	})
+
+	Convey("Applying defaults walks pointers, slices, maps and interfaces", t, func() {
+		kitchen := "kitchen"
+		dh := &DefaultedHouse{
+			Wings:   map[string]DefaultedRoom{"east": {Doors: 1}},
+			Annexes: map[string]*DefaultedRoom{"west": {Name: &kitchen}},
+			Main:    &DefaultedRoom{},
+			Class:   DefaultedRoom{},
+			Next:    &DefaultedHouse{Name: "cabin"},
+		}
+		dh.Next.Next = dh
+		So(decode.ApplyDefaults(dh), ShouldBeNil)
+
+		So(dh.Name, ShouldEqual, "home")
+		So(dh.Rooms, ShouldResemble, []DefaultedRoom{{Name: &hall, Doors: 2}})
+		So(dh.Wings["east"], ShouldResemble, DefaultedRoom{Name: &hall, Doors: 1})
+		So(dh.Annexes["west"], ShouldResemble, &DefaultedRoom{Name: &kitchen, Doors: 2})
+		So(dh.Main, ShouldResemble, &DefaultedRoom{Name: &hall, Doors: 2})
+		So(dh.Class, ShouldResemble, DefaultedRoom{Name: &hall, Doors: 2})
+		So(dh.Next.Name, ShouldEqual, "cabin")
+		So(dh.Next.Rooms, ShouldResemble, []DefaultedRoom{{Name: &hall, Doors: 2}})
+	})
+
+	Convey("Applying defaults to OneOf defaults requires a PathFactory", t, func() {
+		swd := &StructWithLiteralDefaults{}
+		So(decode.ApplyDefaults(swd), ShouldNotBeNil)
+
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "StructWithLiteralDefaults.class" {
+				return Accommodation_class_Factory, nil
+			}
+			return nil, nil
+		}
+		swd = &StructWithLiteralDefaults{}
+		So(decode.ApplyDefaultsWithPathFactory(swd, pf), ShouldBeNil)
+		house := "House"
+		rooms := 3
+		So(swd.Class, ShouldResemble, &House{Type: &house, Rooms: &rooms})
+	})
+
+	Convey("Applying defaults fails on bad defaults and bad targets", t, func() {
+		type BIS struct {
+			BadIntStr int `default:"aaaa"`
+		}
+		So(decode.ApplyDefaults(&BIS{}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(&[]BIS{{}}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(&map[string]BIS{"a": {}}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(BIS{}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(nil), ShouldNotBeNil)
+	})
+}
+
+type StructWithProviders struct {
+	Created  time.Time  `default:"$now"`
+	PCreated *time.Time `default:"$now"`
+	Day      string     `default:"$now:2006-01-02"`
+	ID       string     `default:"$uuid"`
+	Host     string     `default:"$hostname"`
+	Region   string     `default:"${DECODE_TEST_REGION:-us-east-1}"`
+	Zone     *string    `default:"${DECODE_TEST_ZONE:-a}"`
+	Price    string     `default:"$$5"`
+	Answer   int        `default:"$answer"`
+}
+
+func TestDefaultProviders(t *testing.T) {
+	decode.RegisterDefaultProvider("answer", func(string) (string, error) { return "42", nil })
+	decode.RegisterDefaultProvider("broken", func(string) (string, error) { return "", errors.New("broken") })
+
+	Convey("Setting defaults from providers", t, func() {
+		So(os.Setenv("DECODE_TEST_ZONE", "b"), ShouldBeNil)
+		defer os.Unsetenv("DECODE_TEST_ZONE")
+
+		before := time.Now().Add(-time.Second)
+		swp := &StructWithProviders{}
+		_, err := decode.DecodeIntoWithDefaults(map[string]interface{}{}, swp, testSPF, true)
+		So(err, ShouldBeNil)
+
+		So(swp.Created, ShouldHappenAfter, before)
+		So(swp.PCreated, ShouldNotBeNil)
+		So(*swp.PCreated, ShouldHappenAfter, before)
+		So(swp.Day, ShouldEqual, time.Now().UTC().Format("2006-01-02"))
+		So(regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$").MatchString(swp.ID), ShouldBeTrue)
+		host, _ := os.Hostname()
+		So(swp.Host, ShouldEqual, host)
+		So(swp.Region, ShouldEqual, "us-east-1")
+		zone := "b"
+		So(swp.Zone, ShouldResemble, &zone)
+		So(swp.Price, ShouldEqual, "$5")
+		So(swp.Answer, ShouldEqual, 42)
+	})
+
+	Convey("Providers are consulted by ApplyDefaults", t, func() {
+		swp := &StructWithProviders{}
+		So(decode.ApplyDefaults(swp), ShouldBeNil)
+		So(swp.ID, ShouldNotBeEmpty)
+		So(swp.Answer, ShouldEqual, 42)
+	})
+
+	Convey("Bad provider references", t, func() {
+		type UP struct {
+			Val string `default:"$unknown"`
+		}
+		type UE struct {
+			Val string `default:"${DECODE_TEST_UNSET}"`
+		}
+		type BP struct {
+			Val string `default:"$broken"`
+		}
+		type BC struct {
+			Val int `default:"$hostname"`
+		}
+
+		So(decode.ApplyDefaults(&UP{}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(&UE{}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(&BP{}), ShouldNotBeNil)
+		So(decode.ApplyDefaults(&BC{}), ShouldNotBeNil)
+	})
+}
+
+type DefaultedPalace struct {
+	Halls  *int
+	Towers *int
+}
+
+// SetDefaults sets Towers from the number of Halls
+func (p *DefaultedPalace) SetDefaults() {
+	if p.Towers == nil && p.Halls != nil {
+		towers := *p.Halls / 2
+		p.Towers = &towers
+	}
+}
+
+type DefaultedEstate struct {
+	Main    interface{}
+	Palaces []DefaultedPalace
+	Ruin    *DefaultedPalace
+}
+
+type CountingDefaulter struct {
+	Name  string
+	Calls int
+}
+
+func (c *CountingDefaulter) SetDefaults() {
+	c.Calls++
+	if c.Name == "" {
+		c.Name = "unnamed"
+	}
+}
+
+func TestDefaulters(t *testing.T) {
+	estateSPF := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if path == "DefaultedEstate.main" {
+			return func(map[string]interface{}) (interface{}, error) { return &DefaultedPalace{}, nil }, nil
+		}
+		return nil, nil
+	}
+	four, eight, two := 4, 8, 2
+
+	Convey("SetDefaults is called on objects, OneOf children and array elements", t, func() {
+		m := map[string]interface{}{
+			"main":    map[string]interface{}{"halls": 8},
+			"palaces": []interface{}{map[string]interface{}{"halls": 8}, map[string]interface{}{"halls": 8, "towers": 2}},
+			"ruin":    map[string]interface{}{"halls": 8},
+		}
+		de := &DefaultedEstate{}
+		_, err := decode.DecodeIntoWithDefaults(m, de, estateSPF, true)
+		So(err, ShouldBeNil)
+		So(de.Main, ShouldResemble, &DefaultedPalace{Halls: &eight, Towers: &four})
+		So(de.Palaces, ShouldResemble, []DefaultedPalace{{Halls: &eight, Towers: &four}, {Halls: &eight, Towers: &two}})
+		So(de.Ruin, ShouldResemble, &DefaultedPalace{Halls: &eight, Towers: &four})
+
+		de = &DefaultedEstate{}
+		_, err = decode.DecodeInto(m, de, estateSPF)
+		So(err, ShouldBeNil)
+		So(de.Ruin, ShouldResemble, &DefaultedPalace{Halls: &eight})
+	})
+
+	Convey("SetDefaults is called at the configured stage", t, func() {
+		named := map[string]interface{}{"name": "spot"}
+		for _, tc := range []struct {
+			mode  decode.DefaulterMode
+			m     map[string]interface{}
+			name  string
+			calls int
+		}{
+			{decode.DefaultersAfter, named, "spot", 1},
+			{decode.DefaultersAfter, map[string]interface{}{}, "unnamed", 1},
+			{decode.DefaultersBefore, named, "spot", 1},
+			{decode.DefaultersBefore, map[string]interface{}{}, "unnamed", 1},
+			{decode.DefaultersBeforeAndAfter, named, "spot", 2},
+			{decode.DefaultersOff, map[string]interface{}{}, "", 0},
+		} {
+			cd := &CountingDefaulter{}
+			_, err := decode.DecodeIntoWithOptions(tc.m, cd, nil, decode.Options{ApplyDefaults: true, Defaulters: tc.mode})
+			So(err, ShouldBeNil)
+			So(cd.Name, ShouldEqual, tc.name)
+			So(cd.Calls, ShouldEqual, tc.calls)
+		}
+	})
+
+	Convey("ApplyDefaults calls SetDefaults at the configured stage", t, func() {
+		for _, tc := range []struct {
+			mode  decode.DefaulterMode
+			name  string
+			calls int
+		}{
+			{decode.DefaultersAfter, "unnamed", 1},
+			{decode.DefaultersBefore, "unnamed", 1},
+			{decode.DefaultersBeforeAndAfter, "unnamed", 2},
+			{decode.DefaultersOff, "", 0},
+		} {
+			cd := &CountingDefaulter{}
+			So(decode.ApplyDefaultsWithOptions(cd, nil, decode.Options{Defaulters: tc.mode}), ShouldBeNil)
+			So(cd.Name, ShouldEqual, tc.name)
+			So(cd.Calls, ShouldEqual, tc.calls)
+		}
+	})
+
+	Convey("SetDefaults is called by ApplyDefaults", t, func() {
+		de := &DefaultedEstate{Main: &DefaultedPalace{Halls: &eight}, Palaces: []DefaultedPalace{{Halls: &eight}}}
+		So(decode.ApplyDefaults(de), ShouldBeNil)
+		So(de.Main, ShouldResemble, &DefaultedPalace{Halls: &eight, Towers: &four})
+		So(de.Palaces, ShouldResemble, []DefaultedPalace{{Halls: &eight, Towers: &four}})
+	})
+}
+
+type StructWithProfiles struct {
+	Host     string `default:"localhost" default_prod:"example.com"`
+	Port     int    `default:"8080" default_dev:"3000"`
+	LogLevel string `envDefault:"info"`
+}
+
+func TestDefaultTags(t *testing.T) {
+	Convey("Defaults are read from the configured tag", t, func() {
+		swp := &StructWithProfiles{}
+		_, err := decode.DecodeIntoWithOptions(map[string]interface{}{}, swp, nil, decode.Options{ApplyDefaults: true, DefaultTags: []string{"envDefault"}})
+		So(err, ShouldBeNil)
+		So(swp, ShouldResemble, &StructWithProfiles{LogLevel: "info"})
+	})
+
+	Convey("Default tags form a fallback chain", t, func() {
+		dev := decode.Options{ApplyDefaults: true, DefaultTags: []string{"default_dev", "default"}}
+		swp := &StructWithProfiles{}
+		_, err := decode.DecodeIntoWithOptions(map[string]interface{}{"host": "db"}, swp, nil, dev)
+		So(err, ShouldBeNil)
+		So(swp, ShouldResemble, &StructWithProfiles{Host: "db", Port: 3000})
+
+		swp = &StructWithProfiles{}
+		So(decode.ApplyDefaultsWithOptions(swp, nil, decode.Options{DefaultTags: []string{"default_prod", "default"}}), ShouldBeNil)
+		So(swp, ShouldResemble, &StructWithProfiles{Host: "example.com", Port: 8080})
+	})
+
+	Convey("The default tag is used when none is configured", t, func() {
+		swp := &StructWithProfiles{}
+		So(decode.ApplyDefaultsWithOptions(swp, nil, decode.Options{}), ShouldBeNil)
+		So(swp, ShouldResemble, &StructWithProfiles{Host: "localhost", Port: 8080})
+	})
+}
+
+type BadDefaultsChild struct {
+	Count int    `default:"abc"`
+	Name  string `default:"fine"`
+}
+
+type BadDefaults struct {
+	Flag     bool        `default:"maybe"`
+	Chan     chan int    `default:"1"`
+	Provider string      `default:"$unknown"`
+	List     []int       `default:"[1,"`
+	Class    interface{} `default:"{"`
+	Child    *BadDefaultsChild
+	Children []BadDefaultsChild
+	ByName   map[string]BadDefaultsChild
+	Inline   struct {
+		Size uint `default:"-1"`
+	}
+	hidden string `default:"x"`
+}
+
+func TestCheckDefaults(t *testing.T) {
+	Convey("Valid defaults pass", t, func() {
+		So(decode.CheckDefaults(StructWithDefaults{}, &StructWithProviders{}, DefaultedHouse{}, StructWithProfiles{}, nil), ShouldBeNil)
+	})
+
+	Convey("Providers are not called when defaults are checked", t, func() {
+		type EP struct {
+			Region string `default:"${DECODE_TEST_UNSET}"`
+			Broken string `default:"$broken"`
+		}
+		decode.RegisterDefaultProvider("broken", func(string) (string, error) { return "", errors.New("broken") })
+		So(decode.CheckDefaults(EP{}), ShouldBeNil)
+	})
+
+	Convey("Provider references are checked for their syntax and fallback", t, func() {
+		type BE struct {
+			Name  string `default:"${:-x}"`
+			Count int    `default:"${DECODE_TEST_UNSET:-many}"`
+			Open  string `default:"${DECODE_TEST_UNSET"`
+			Fine  int    `default:"${DECODE_TEST_UNSET:-3}"`
+		}
+		So(errorPaths(decode.CheckDefaults(BE{})), ShouldResemble, []string{"BE.Name", "BE.Count", "BE.Open"})
+	})
+
+	Convey("Every bad default is reported with its path", t, func() {
+		err := decode.CheckDefaults(&BadDefaults{})
+		So(err, ShouldNotBeNil)
+		errs, ok := err.(decode.Errors)
+		So(ok, ShouldBeTrue)
+		paths := []string{}
+		for _, e := range errs {
+			fe, ok := e.(*decode.FieldError)
+			So(ok, ShouldBeTrue)
+			paths = append(paths, fe.Path)
+		}
+		So(paths, ShouldResemble, []string{
+			"BadDefaults.Flag",
+			"BadDefaults.Chan",
+			"BadDefaults.Provider",
+			"BadDefaults.List",
+			"BadDefaults.Class",
+			"BadDefaultsChild.Count",
+			"BadDefaults.Inline.Size",
+			"BadDefaults.hidden",
+		})
+		So(err.Error(), ShouldContainSubstring, "BadDefaultsChild.Count: ")
+	})
+
+	Convey("Every tag of a profile is checked", t, func() {
+		type BP struct {
+			Port int `default:"80" default_dev:"abc"`
+		}
+		So(decode.CheckDefaults(BP{}), ShouldBeNil)
+		So(decode.CheckDefaultsWithOptions(nil, decode.Options{DefaultTags: []string{"default_dev", "default"}}, BP{}), ShouldNotBeNil)
+	})
+
+	Convey("OneOf defaults are resolved with a PathFactory", t, func() {
+		So(decode.CheckDefaults(StructWithLiteralDefaults{}), ShouldBeNil)
+		So(decode.CheckDefaultsWithOptions(testSPF, decode.Options{}, StructWithLiteralDefaults{}), ShouldNotBeNil)
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "StructWithLiteralDefaults.class" {
+				return Accommodation_class_Factory, nil
+			}
+			return nil, nil
+		}
+		So(decode.CheckDefaultsWithOptions(pf, decode.Options{}, StructWithLiteralDefaults{}), ShouldBeNil)
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an error found at a given path of a document or type
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Path, strings.TrimSpace(e.Err.Error()))
+}
+
+// Errors holds every error found when the whole of a document or type is checked
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = strings.TrimSpace(err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// errOrNil returns errs as an error, or nil if it is empty
+func (e Errors) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// joinPath returns the path of the property k of the object at path
+func joinPath(path, k string) string {
+	if path == "" {
+		return k
+	}
+	return path + "." + k
+}
+
+// indexPath returns the path of the i'th element of the array at path
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
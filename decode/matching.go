@@ -0,0 +1,128 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Matching describes how discriminator values of a payload are matched with the known ones. The canonical value of a
+// matched discriminator replaces the payload's in the object given to the factory, so that it is the one found in the
+// decoded object. The decoding functions give factories a copy of the payload's objects, which are left unchanged
+type Matching struct {
+	// IgnoreCase matches values whatever their case, so that "cat" and "CAT" both match "Cat"
+	IgnoreCase bool
+	// Aliases maps alternative values, such as the former value of a renamed type, to canonical ones
+	Aliases map[string]string
+	// Values lists the canonical values for Decode, which cannot ask its Factory for the values it knows. They are
+	// only needed to ignore case
+	Values []string
+}
+
+// canonical returns the canonical value of the discriminator value v, and whether it is one of known
+func (mt Matching) canonical(v string, known map[string]func() interface{}) (string, bool) {
+	if a, ok := mt.lookupAlias(v); ok {
+		v = a
+	}
+	if _, ok := known[v]; ok {
+		return v, true
+	}
+	if mt.IgnoreCase {
+		for _, k := range sortedKeys(known) {
+			if strings.EqualFold(k, v) {
+				return k, true
+			}
+		}
+	}
+	return v, false
+}
+
+func (mt Matching) lookupAlias(v string) (string, bool) {
+	if a, ok := mt.Aliases[v]; ok {
+		return a, true
+	}
+	if mt.IgnoreCase {
+		aliases := make([]string, 0, len(mt.Aliases))
+		for k := range mt.Aliases {
+			aliases = append(aliases, k)
+		}
+		sort.Strings(aliases)
+		for _, k := range aliases {
+			if strings.EqualFold(k, v) {
+				return mt.Aliases[k], true
+			}
+		}
+	}
+	return v, false
+}
+
+// kind returns the canonical value of the discriminator value v for Decode
+func (mt Matching) kind(v string) string {
+	known := make(map[string]func() interface{}, len(mt.Values))
+	for _, k := range mt.Values {
+		known[k] = nil
+	}
+	c, _ := mt.canonical(v, known)
+	return c
+}
+
+func sortedKeys(m map[string]func() interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeBack replaces the string value dp of the discriminator dk of o with its canonical value c. The objects nested
+// in o which hold a discriminator given as a JSON pointer are replaced by copies rather than changed
+func writeBack(o map[string]interface{}, dk string, dp interface{}, c string) {
+	if s, ok := dp.(string); !ok || s == c {
+		return
+	}
+	tokens, ok := pointerTokens(dk)
+	if !ok {
+		o[dk] = c
+		return
+	}
+	for _, t := range tokens[:len(tokens)-1] {
+		n, ok := o[t].(map[string]interface{})
+		if !ok {
+			return
+		}
+		n = copyObject(n)
+		o[t] = n
+		o = n
+	}
+	o[tokens[len(tokens)-1]] = c
+}
+
+// copyObject returns a shallow copy of the object o
+func copyObject(o map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(o))
+	for k, v := range o {
+		c[k] = v
+	}
+	return c
+}
+
+// setDiscriminatorField sets the string field of r for its discriminator property dk to v
+func setDiscriminatorField(r interface{}, dk string, v string) {
+	f, ok := discriminatorField(reflect.ValueOf(r), dk)
+	if !ok || !f.CanSet() {
+		return
+	}
+	switch {
+	case f.Kind() == reflect.String:
+		f.SetString(v)
+	case f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.String:
+		p := reflect.New(f.Type().Elem())
+		p.Elem().SetString(v)
+		f.Set(p)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+func TestMatching(t *testing.T) {
+	mt := decode.Matching{IgnoreCase: true, Aliases: map[string]string{"LOUD": "MEOW"}}
+	pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		switch path {
+		case "PetOwner.favorite":
+			return decode.NewOneOfFactoryWithMatching(path, "type", map[string]func() interface{}{"Cat": NewCat, "Dog": NewDog}, mt), nil
+		case "Cat.sound":
+			return decode.DiscriminatorFactoryWithMatching(path, mt, NewMeow, NewPurr), nil
+		}
+		return SchemaPathFactory(path)
+	}
+
+	Convey("Factories match values whatever their case and write back the canonical one", t, func() {
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "favorite": { "type": "CAT", "sound": { "type": "purr" } } }`), po, pf)
+		So(err, ShouldBeNil)
+		c := po.Favorite.(*Cat)
+		So(*c.Type, ShouldEqual, "Cat")
+		So(*c.Sound.(*Purr).Type, ShouldEqual, "PURR")
+	})
+
+	Convey("Factories leave the decoded payload unchanged", t, func() {
+		m := map[string]interface{}{"favorite": map[string]interface{}{"type": "cat", "sound": map[string]interface{}{"type": "purr"}}}
+		r, err := decode.DecodeInto(m, &PetOwner{}, pf)
+		So(err, ShouldBeNil)
+		So(*r.(*PetOwner).Favorite.(*Cat).Type, ShouldEqual, "Cat")
+		So(m, ShouldResemble, map[string]interface{}{"favorite": map[string]interface{}{"type": "cat", "sound": map[string]interface{}{"type": "purr"}}})
+
+		meta := map[string]interface{}{"kind": "PARCEL"}
+		f := decode.NewOneOfFactoryWithMatching("Box.content", "/meta/kind", map[string]func() interface{}{"parcel": NewParcel}, mt)
+		_, err = f(map[string]interface{}{"meta": meta})
+		So(err, ShouldBeNil)
+		So(meta, ShouldResemble, map[string]interface{}{"kind": "PARCEL"})
+	})
+
+	Convey("Factories resolve aliases", t, func() {
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "favorite": { "type": "cat", "sound": { "type": "loud" } } }`), po, pf)
+		So(err, ShouldBeNil)
+		So(*po.Favorite.(*Cat).Sound.(*Meow).Type, ShouldEqual, "MEOW")
+	})
+
+	Convey("Values are matched exactly by default", t, func() {
+		_, err := decode.NewOneOfFactory("PetOwner.favorite", "type", map[string]func() interface{}{"Cat": NewCat})(map[string]interface{}{"type": "cat"})
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "favorite": { "type": "cow" } }`), &PetOwner{}, pf)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("DecodeWithMatching matches the listed values and sets discriminator fields", t, func() {
+		f := func(kind string) (interface{}, error) {
+			switch kind {
+			case "walker":
+				return &Walker{}, nil
+			case "leash":
+				return &Leash{}, nil
+			}
+			return nil, fmt.Errorf("cannot find type %s", kind)
+		}
+		m := map[string]interface{}{
+			"type":  "Walker",
+			"leash": map[string]interface{}{"type": "LEAD"},
+		}
+		_, err := decode.Decode(m, "type", f)
+		So(err, ShouldNotBeNil)
+
+		wm := decode.Matching{IgnoreCase: true, Aliases: map[string]string{"lead": "leash"}, Values: []string{"walker", "leash"}}
+		r, err := decode.DecodeWithMatching(m, "type", f, wm)
+		So(err, ShouldBeNil)
+		So(*r.(*Walker).Type, ShouldEqual, "walker")
+		So(r.(*Walker).Leash, ShouldHaveSameTypeAs, &Leash{})
+	})
+}
+
+func TestVerifyDiscriminators(t *testing.T) {
+	verify := decode.Options{VerifyDiscriminators: true}
+	mapped := decode.Options{
+		VerifyDiscriminators:  true,
+		DiscriminatorMappings: map[string]map[string]string{"Cat.sound": {"LOUD": "MEOW"}},
+	}
+
+	Convey("Constructors agreeing with the payload pass", t, func() {
+		c := &Cat{}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "type": "Cat", "sound": { "type": "PURR" } }`), c, SchemaPathFactory, verify)
+		So(err, ShouldBeNil)
+		So(*c.Sound.(*Purr).Type, ShouldEqual, "PURR")
+	})
+
+	Convey("Constructors disagreeing with the payload are flagged", t, func() {
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "sound": { "type": "LOUD" } }`), &Cat{}, SchemaPathFactory, verify)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "sets discriminator 'type' to 'MEOW', not 'LOUD'")
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "sound": { "type": "LOUD" } }`), &Cat{}, SchemaPathFactory)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Mapped values pass and the constructor's value is kept", t, func() {
+		c := &Cat{}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "sound": { "type": "LOUD", "squeel": "hi" } }`), c, SchemaPathFactory, mapped)
+		So(err, ShouldBeNil)
+		So(*c.Sound.(*Meow).Type, ShouldEqual, "MEOW")
+		So(*c.Sound.(*Meow).Squeel, ShouldEqual, "hi")
+	})
+
+	Convey("Objects whose discriminator field cannot be inspected are not verified", t, func() {
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "PetOwner.favorite" {
+				return decode.NewOneOfFactory(path, "kind", map[string]func() interface{}{"hidden": NewHidden}), nil
+			}
+			return nil, nil
+		}
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "kind": "hidden", "name": "x" } }`), po, pf, verify)
+		So(err, ShouldBeNil)
+		So(*po.Favorite.(*Hidden).Name, ShouldEqual, "x")
+	})
+
+	Convey("VerifyConstructors reports every inconsistent constructor", t, func() {
+		fm := map[string]func() interface{}{
+			"PURR": NewPurr,
+			"LOUD": NewMeow,
+			"WARN": NewGrowl,
+			"X":    NewUntyped,
+		}
+		err := decode.VerifyConstructors("Cat.sound", fm, nil)
+		So(errorPaths(err), ShouldResemble, []string{"Cat.sound(type=LOUD)", "Cat.sound(X)"})
+
+		delete(fm, "X")
+		So(decode.VerifyConstructors("Cat.sound", fm, map[string]string{"LOUD": "MEOW"}), ShouldBeNil)
+	})
+}
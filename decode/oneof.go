@@ -0,0 +1,726 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+)
+
+// Discriminated is implemented by the types of a OneOf family, naming the property which holds their discriminator
+type Discriminated interface {
+	Discriminator() string
+}
+
+// DiscriminatorFactory returns a OneOfFactory for the objects at path which picks one of the constructors by its
+// discriminator. The discriminator property of each constructor's type is named by its Discriminator method, and the
+// value it is matched against is the one the constructor sets, so types of families using different discriminator
+// properties can be mixed. Discriminator may return a JSON pointer such as "/meta/kind", naming a field of a nested
+// struct
+func DiscriminatorFactory(path string, ctors ...func() interface{}) OneOfFactory {
+	return DiscriminatorFactoryWithMatching(path, Matching{}, ctors...)
+}
+
+// DiscriminatorFactoryWithMatching is DiscriminatorFactory matching discriminator values as described by mt
+func DiscriminatorFactoryWithMatching(path string, mt Matching, ctors ...func() interface{}) OneOfFactory {
+	// property -> discriminator value -> constructor
+	fm := map[string]map[string]func() interface{}{}
+	var err error
+	for _, ctor := range ctors {
+		var dk, dv string
+		if dk, dv, err = discriminatorOf(ctor()); err != nil {
+			err = fmt.Errorf("cannot use constructor for OneOf field '%s': %s", path, err)
+			break
+		}
+		if fm[dk] == nil {
+			fm[dk] = map[string]func() interface{}{}
+		}
+		if _, ok := fm[dk][dv]; ok {
+			err = fmt.Errorf("discriminator value '%s' of property '%s' is registered twice for OneOf field '%s'", dv, dk, path)
+			break
+		}
+		fm[dk][dv] = ctor
+	}
+	dks := make([]string, 0, len(fm))
+	for dk := range fm {
+		dks = append(dks, dk)
+	}
+	sort.Strings(dks)
+
+	return func(o map[string]interface{}) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		var unknown *UnknownDiscriminatorError
+		for _, dk := range dks {
+			dp, _ := lookupDiscriminator(o, dk)
+			dv, ok := discriminatorValue(dp)
+			if !ok {
+				continue
+			}
+			if c, ok := mt.canonical(dv, fm[dk]); ok {
+				writeBack(o, dk, dp, c)
+				return fm[dk][c](), nil
+			}
+			if unknown == nil {
+				unknown = &UnknownDiscriminatorError{Path: path, Property: dk, Value: dv}
+			}
+		}
+		if unknown != nil {
+			return nil, unknown
+		}
+		return nil, fmt.Errorf("no discriminator property %v of OneOf field '%s' has a known value", dks, path)
+	}
+}
+
+// NewOneOfFactory returns a OneOfFactory for the objects at path which calls the constructor of fm keyed by the value
+// of their discriminator property dk. Besides strings, discriminators may be numbers, keyed as in "3" or "1.5" and
+// matched by value so that 3 and 3.0 are the same, or booleans, keyed as "true" or "false". dk may be a JSON pointer
+// such as "/meta/kind" to a discriminator held in a nested object
+func NewOneOfFactory(path, dk string, fm map[string]func() interface{}) OneOfFactory {
+	return NewOneOfFactoryWithMatching(path, dk, fm, Matching{})
+}
+
+// NewOneOfFactoryWithMatching is NewOneOfFactory matching discriminator values as described by mt
+func NewOneOfFactoryWithMatching(path, dk string, fm map[string]func() interface{}, mt Matching) OneOfFactory {
+	nm := map[string]func() interface{}{}
+	for k, ctor := range fm {
+		if n, err := strconv.ParseFloat(k, 64); err == nil {
+			nm[formatNumber(n)] = ctor
+		}
+	}
+	return func(o map[string]interface{}) (interface{}, error) {
+		dp, ok := lookupDiscriminator(o, dk)
+		if !ok {
+			return nil, fmt.Errorf("expecting OneOf object at path '%s' to have a discriminator property '%s'", path, dk)
+		}
+		dv, ok := discriminatorValue(dp)
+		if !ok {
+			return nil, fmt.Errorf("expecting OneOf field '%s's discriminator property '%s' value to be a string, number or boolean", path, dk)
+		}
+		c, ok := mt.canonical(dv, fm)
+		ctor := fm[c]
+		if _, isString := dp.(string); !isString && !ok {
+			ctor, ok = nm[c]
+		}
+		if !ok {
+			return nil, &UnknownDiscriminatorError{Path: path, Property: dk, Value: dv}
+		}
+		writeBack(o, dk, dp, c)
+		return ctor(), nil
+	}
+}
+
+// discriminatorValue returns a discriminator value as a string. Numbers are formatted so that equal values give
+// the same string whatever their type, and ok is false for values which cannot be discriminators
+func discriminatorValue(v interface{}) (dv string, ok bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case bool:
+		return strconv.FormatBool(t), true
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+		n, err := t.Float64()
+		return formatNumber(n), err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return formatNumber(rv.Float()), true
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true
+	}
+	return "", false
+}
+
+// formatNumber formats n without exponent or trailing zeros, so 3.0 gives "3"
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// InferenceError is returned when an object matches none of the candidate types of InferFactory or AnyOf, or more
+// than one of InferFactory. Path is the OneOf field of InferFactory, or the path of the AnyOf object in the payload
+type InferenceError struct {
+	Path string
+	// Matched names the types which the object matches
+	Matched []string
+	// Rejected tells why the object does not match each other type, by type name
+	Rejected map[string]error
+}
+
+func (e *InferenceError) Error() string {
+	if len(e.Matched) > 1 {
+		return fmt.Sprintf("object at '%s' matches more than one type: %v", e.Path, e.Matched)
+	}
+	names := make([]string, 0, len(e.Rejected))
+	for n := range e.Rejected {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, n := range names {
+		msgs[i] = fmt.Sprintf("%s (%s)", n, strings.TrimSpace(e.Rejected[n].Error()))
+	}
+	return fmt.Sprintf("object at '%s' matches no type: %s", e.Path, strings.Join(msgs, ", "))
+}
+
+// InferFactory returns a OneOfFactory for the objects at path which have no discriminator. The object is decoded
+// into each of the constructors' types in strict mode, where unknown properties, values of the wrong JSON type and
+// every failed check are errors, and the one type it matches is made. pf resolves the OneOf fields of the
+// candidates. An *InferenceError is returned if no type or more than one matches
+func InferFactory(path string, pf PathFactory, ctors ...func() interface{}) OneOfFactory {
+	return func(o map[string]interface{}) (interface{}, error) {
+		ie := &InferenceError{Path: path, Rejected: map[string]error{}}
+		var match func() interface{}
+		for _, ctor := range ctors {
+			c := ctor()
+			name := typeName(c)
+			d := &decoder{pf: pf, collect: true, strict: true, rejectUnknown: true}
+			_, err := d.decodeInto(o, c, "")
+			if err == nil {
+				err = d.errs.errOrNil()
+			}
+			if err != nil {
+				ie.Rejected[name] = err
+				continue
+			}
+			ie.Matched = append(ie.Matched, name)
+			match = ctor
+		}
+		if len(ie.Matched) != 1 {
+			return nil, ie
+		}
+		return match(), nil
+	}
+}
+
+// Shape describes the objects of a OneOf family which are made by New. An object has the shape if it has every
+// property of Present, none of Absent, and the value of each property of Match satisfies its predicate
+type Shape struct {
+	Present []string
+	Absent  []string
+	Match   map[string]func(v interface{}) bool
+	New     func() interface{}
+}
+
+// matches tells if the object o has the shape
+func (s Shape) matches(o map[string]interface{}) bool {
+	for _, k := range s.Present {
+		if _, ok := o[k]; !ok {
+			return false
+		}
+	}
+	for _, k := range s.Absent {
+		if _, ok := o[k]; ok {
+			return false
+		}
+	}
+	for k, p := range s.Match {
+		v, ok := o[k]
+		if !ok || !p(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShapeFactory returns a OneOfFactory for the objects at path which makes the type of the first of shapes the object
+// has, for payloads identifying their type by the properties they hold rather than by a discriminator
+func ShapeFactory(path string, shapes ...Shape) OneOfFactory {
+	return func(o map[string]interface{}) (interface{}, error) {
+		for _, s := range shapes {
+			if s.matches(o) {
+				return s.New(), nil
+			}
+		}
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("object with properties %v does not have the shape of any type of OneOf field '%s'", keys, path)
+	}
+}
+
+// Equals returns a Shape predicate matching values equal to v. Numbers are compared by value, so that 3 matches 3.0
+func Equals(v interface{}) func(interface{}) bool {
+	want, scalar := discriminatorValue(v)
+	return func(got interface{}) bool {
+		if gv, ok := discriminatorValue(got); ok && scalar {
+			_, ws := v.(string)
+			_, gs := got.(string)
+			return gv == want && ws == gs
+		}
+		return reflect.DeepEqual(got, v)
+	}
+}
+
+// TaggingStyle is a representation of the objects of a OneOf field
+type TaggingStyle int
+
+const (
+	// InternallyTagged objects hold their discriminator property, as in {"type": "Cat", "name": "tom"}
+	InternallyTagged TaggingStyle = iota
+	// ExternallyTagged objects are wrapped in an object whose single property is named by their discriminator,
+	// as in {"Cat": {"name": "tom"}}
+	ExternallyTagged
+	// AdjacentlyTagged objects are held by a property next to their discriminator, as in
+	// {"type": "Cat", "value": {"name": "tom"}}
+	AdjacentlyTagged
+)
+
+// Tagging describes the representation of the objects of a OneOf field. Externally and adjacently tagged objects are
+// passed to the field's OneOfFactory as internally tagged ones, so that the same factory resolves them
+type Tagging struct {
+	Style TaggingStyle
+	// Discriminator is the property the field's OneOfFactory reads the discriminator from, which is added to the
+	// object it is passed. It defaults to Tag
+	Discriminator string
+	// Tag and Content are the properties of an adjacently tagged object holding its discriminator and its content.
+	// They default to "type" and "value", and Tag is also the default Discriminator of externally tagged objects
+	Tag     string
+	Content string
+}
+
+// untag returns the internally tagged form of the OneOf object o at path, and the path of its content
+func (t Tagging) untag(o map[string]interface{}, path string) (map[string]interface{}, string, error) {
+	tag, content, dk := t.Tag, t.Content, t.Discriminator
+	if tag == "" {
+		tag = "type"
+	}
+	if content == "" {
+		content = "value"
+	}
+	if dk == "" {
+		dk = tag
+	}
+
+	var dv interface{}
+	var c interface{}
+	switch t.Style {
+	case InternallyTagged:
+		return o, path, nil
+	case ExternallyTagged:
+		if len(o) != 1 {
+			return nil, path, fmt.Errorf("expecting externally tagged OneOf object to have a single property, found %d", len(o))
+		}
+		for k, v := range o {
+			dv, c, path = k, v, joinPath(path, k)
+		}
+	case AdjacentlyTagged:
+		var ok bool
+		if dv, ok = o[tag]; !ok {
+			return nil, path, fmt.Errorf("expecting adjacently tagged OneOf object to have a discriminator property '%s'", tag)
+		}
+		for k := range o {
+			if k != tag && k != content {
+				return nil, path, fmt.Errorf("Unknown property '%s' of adjacently tagged OneOf object", k)
+			}
+		}
+		// objects without content are made from their discriminator alone
+		c, ok = o[content]
+		if !ok {
+			c = map[string]interface{}{}
+		}
+		path = joinPath(path, content)
+	default:
+		return nil, path, fmt.Errorf("unknown tagging style %d", t.Style)
+	}
+
+	co, ok := c.(map[string]interface{})
+	if !ok {
+		return nil, path, fmt.Errorf("expecting the content of a tagged OneOf object to be an object")
+	}
+	m := make(map[string]interface{}, len(co)+1)
+	for k, v := range co {
+		m[k] = v
+	}
+	m[dk] = dv
+	return m, path, nil
+}
+
+// UnknownDiscriminatorError is returned by a OneOfFactory for an object whose discriminator value has no known type.
+// Factories returning it, or the equivalent error of generated factories, let DecodeIntoWithOptions fall back to
+// Unknown
+type UnknownDiscriminatorError struct {
+	// Path is the OneOf field, such as "PetOwner.favorite"
+	Path     string
+	Property string
+	Value    string
+}
+
+func (e *UnknownDiscriminatorError) Error() string {
+	return fmt.Sprintf("Unknown discriminator value '%s' when handling OneOf field '%s'", e.Value, e.Path)
+}
+
+// Unknown holds an object of a OneOf field whose discriminator value has no known type, such as a type added by a
+// newer version of an API, when Options.UnknownFallback is set
+type Unknown struct {
+	// Property and Value are the discriminator of the object
+	Property string
+	Value    string
+	// Raw is the object as found in the payload, still tagged if its field is externally or adjacently tagged
+	Raw map[string]interface{}
+}
+
+// generatedUnknown matches the error returned by generated factories for an unknown discriminator value. They give
+// the field's path and the value in the reverse order of UnknownDiscriminatorError
+var generatedUnknown = regexp.MustCompile(`^Unknown discriminator value '(.*)' when handling OneOf field '(.*)'$`)
+
+// unknownDiscriminator returns the UnknownDiscriminatorError described by err, the error of the factory of a OneOf
+// field for the object o. The errors of generated factories are recognised as well, their discriminator property
+// being the property of o holding the unknown value
+func unknownDiscriminator(o map[string]interface{}, err error) (*UnknownDiscriminatorError, bool) {
+	if ue, ok := err.(*UnknownDiscriminatorError); ok {
+		return ue, true
+	}
+	sm := generatedUnknown.FindStringSubmatch(err.Error())
+	if sm == nil {
+		return nil, false
+	}
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, c := range [][2]string{{sm[1], sm[2]}, {sm[2], sm[1]}} {
+		path, value := c[0], c[1]
+		for _, k := range keys {
+			if s, ok := o[k].(string); ok && s == value {
+				return &UnknownDiscriminatorError{Path: path, Property: k, Value: value}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// fallback makes an Unknown for the object raw of a OneOf field held in a value of type t, if the error of its
+// factory allows it. o is raw as given to the factory, internally tagged
+func (d *decoder) fallback(t reflect.Type, raw, o map[string]interface{}, path string, err error) (*Unknown, bool) {
+	if !d.opts.UnknownFallback {
+		return nil, false
+	}
+	ue, ok := unknownDiscriminator(o, err)
+	if !ok {
+		return nil, false
+	}
+	u := &Unknown{Property: ue.Property, Value: ue.Value, Raw: raw}
+	if !reflect.TypeOf(u).AssignableTo(t) {
+		return nil, false
+	}
+	d.diagnose(path, err)
+	return u, true
+}
+
+// diagnose reports a problem which does not stop decoding to Options.Diagnostics
+func (d *decoder) diagnose(path string, err error) {
+	if d.opts.Diagnostics != nil {
+		d.opts.Diagnostics(path, err)
+	}
+}
+
+// verifyDiscriminator checks that the discriminator value set by the constructor of child, made by the factory of the
+// OneOf field pp for the object o, is the one of o or the one it is mapped to. It returns the discriminator property
+// and value of child, or an empty property if child does not set it
+func (d *decoder) verifyDiscriminator(pp string, o map[string]interface{}, child interface{}) (string, string, error) {
+	if _, ok := child.(Discriminated); !ok {
+		return "", "", nil
+	}
+	dk, want, err := discriminatorOf(child)
+	if err != nil {
+		return "", "", nil
+	}
+	dp, _ := lookupDiscriminator(o, dk)
+	got, ok := discriminatorValue(dp)
+	if !ok {
+		return "", "", fmt.Errorf("expecting OneOf object at path '%s' to have a discriminator property '%s'", pp, dk)
+	}
+	if m, ok := d.opts.DiscriminatorMappings[pp][got]; ok {
+		got = m
+	}
+	if got != want {
+		return "", "", fmt.Errorf("constructor of %T for OneOf field '%s' sets discriminator '%s' to '%s', not '%s'",
+			child, pp, dk, want, got)
+	}
+	return dk, want, nil
+}
+
+// VerifyConstructors checks that the constructors of fm, keyed by discriminator value like the ones of
+// NewOneOfFactory, make Discriminated objects setting their discriminator to that value, or to the one it is mapped
+// to by mappings. It is meant to be called from init() or a unit test, and reports every inconsistent constructor
+// with the QualifiedKind of the OneOf field at path
+func VerifyConstructors(path string, fm map[string]func() interface{}, mappings map[string]string) error {
+	var errs Errors
+	for _, v := range sortedKeys(fm) {
+		dk, dv, err := discriminatorOf(fm[v]())
+		if err != nil {
+			errs = append(errs, &FieldError{Path: fmt.Sprintf("%s(%s)", path, v), Err: err})
+			continue
+		}
+		want := v
+		if m, ok := mappings[v]; ok {
+			want = m
+		}
+		if dv != want {
+			errs = append(errs, &FieldError{
+				Path: QualifiedKind(path, dk, v),
+				Err:  fmt.Errorf("constructor of %T sets discriminator '%s' to '%s', not '%s'", fm[v](), dk, dv, want),
+			})
+		}
+	}
+	return errs.errOrNil()
+}
+
+// CompoundKind returns the kind of an object identified by several discriminator values, such as "Created|2" for a
+// type and a schema version. It keys the constructors of DecodeCompound and CompoundFactory
+func CompoundKind(values ...string) string {
+	return strings.Join(values, "|")
+}
+
+// compoundKind returns the CompoundKind of the values of the discriminators dks of the object o
+func compoundKind(o map[string]interface{}, dks []string) (string, error) {
+	values := make([]string, len(dks))
+	for i, dk := range dks {
+		dp, ok := lookupDiscriminator(o, dk)
+		if !ok {
+			return "", fmt.Errorf("could not find value for discriminator %s in map %#v", dk, o)
+		}
+		if values[i], ok = discriminatorValue(dp); !ok {
+			return "", fmt.Errorf("expecting discriminator property '%s' value to be a string, number or boolean", dk)
+		}
+	}
+	return CompoundKind(values...), nil
+}
+
+// CompoundFactory returns a OneOfFactory for the objects at path identified by the values of several discriminator
+// properties dks, which calls the constructor of fm keyed by their CompoundKind
+func CompoundFactory(path string, dks []string, fm map[string]func() interface{}) OneOfFactory {
+	return func(o map[string]interface{}) (interface{}, error) {
+		kind, err := compoundKind(o, dks)
+		if err != nil {
+			return nil, fmt.Errorf("OneOf field '%s': %s", path, err)
+		}
+		ctor, ok := fm[kind]
+		if !ok {
+			return nil, &UnknownDiscriminatorError{Path: path, Property: CompoundKind(dks...), Value: kind}
+		}
+		return ctor(), nil
+	}
+}
+
+// RootPath is passed to DecodeInto and UnmarshalJSONInto instead of an object to decode a document whose type is chosen
+// like the one of a OneOf field. It is the path given to the PathFactory for the document's factory, such as
+// "PetOwner.favorite" or the name of a union of root types, and the object made by the factory is returned
+type RootPath string
+
+// decodeRoot decodes a document whose type is chosen by the factory of the root path rp
+func (d *decoder) decodeRoot(m map[string]interface{}, rp RootPath) (interface{}, error) {
+	if d.pf == nil {
+		return nil, fmt.Errorf("cannot decode root path '%s' without a PathFactory", rp)
+	}
+	f, err := d.pf(string(rp))
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, fmt.Errorf("no factory for root path '%s'", rp)
+	}
+	return d.decodeOneOf(f, string(rp), reflect.TypeOf((*interface{})(nil)).Elem(), m, "")
+}
+
+// QualifiedKind returns the key of a type in a Factory generated from a schema: the OneOf field's path, such as
+// "Accommodation.class", followed by its discriminator property and value, as in "Accommodation.class(type=BARK)".
+// A root object has no enclosing field, and is keyed by the bare discriminator value
+func QualifiedKind(path, discriminator, value string) string {
+	if path == "" {
+		return value
+	}
+	return fmt.Sprintf("%s(%s=%s)", path, discriminator, value)
+}
+
+// qualifiedPathFactory returns a PathFactory which makes the objects of every OneOf field by calling f with their
+// QualifiedKind. As it cannot tell which paths are OneOf fields it has a factory for every path, and must only be
+// used for interface fields
+func qualifiedPathFactory(discriminator string, f Factory) PathFactory {
+	return func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		return func(o map[string]interface{}) (interface{}, error) {
+			r, _, err := resolveKind(o, discriminator, func(dk, kind string) (interface{}, error) {
+				return f(QualifiedKind(path, dk, kind))
+			})
+			return r, err
+		}, nil
+	}
+}
+
+// DecodeQualified is Decode for a Factory keyed by qualified kinds. m is the object at path, such as
+// "PetOwner.favorite", or a root object keyed by its bare discriminator value if path is empty. The objects of its
+// OneOf fields are made by calling f with the QualifiedKind built from their enclosing type and field
+func DecodeQualified(m map[string]interface{}, path string, discriminator string, f Factory) (interface{}, error) {
+	r, err := qualifiedPathFactory(discriminator, f)(path)
+	if err != nil {
+		return nil, err
+	}
+	o, err := r(m)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeQualifiedInto(m, o, discriminator, f)
+}
+
+// DecodeQualifiedInto decodes m into the root object o, making the objects of its OneOf fields by calling f with
+// the QualifiedKind built from their enclosing type and field
+func DecodeQualifiedInto(m map[string]interface{}, o interface{}, discriminator string, f Factory) (interface{}, error) {
+	d := &decoder{pf: qualifiedPathFactory(discriminator, f), interfaceOneOfs: true}
+	r, err := d.decodeInto(m, o, "")
+	if err != nil {
+		return r, err
+	}
+	return r, d.errs.errOrNil()
+}
+
+// discriminatorOf returns the name and value of the discriminator property of a Discriminated object
+func discriminatorOf(o interface{}) (string, string, error) {
+	dc, ok := o.(Discriminated)
+	if !ok {
+		return "", "", fmt.Errorf("%T does not implement Discriminated", o)
+	}
+	dk := dc.Discriminator()
+	f, ok := discriminatorField(reflect.ValueOf(o), dk)
+	if !ok {
+		return "", "", fmt.Errorf("%T has no field for its discriminator property '%s'", o, dk)
+	}
+	if !f.CanInterface() {
+		return "", "", fmt.Errorf("%T has an unexported field for its discriminator property '%s'", o, dk)
+	}
+	for f.Kind() == reflect.Ptr && !f.IsNil() {
+		f = f.Elem()
+	}
+	dv, ok := discriminatorValue(f.Interface())
+	if f.Kind() == reflect.Ptr || !ok {
+		return "", "", fmt.Errorf("%T does not set its discriminator property '%s'", o, dk)
+	}
+	return dk, dv, nil
+}
+
+// discriminatorField returns the field of o for the discriminator property dk, which may be a JSON pointer
+func discriminatorField(vo reflect.Value, dk string) (reflect.Value, bool) {
+	tokens, ok := pointerTokens(dk)
+	if !ok {
+		tokens = []string{dk}
+	}
+	for _, k := range tokens {
+		if vo, ok = structField(vo, k); !ok {
+			return vo, false
+		}
+	}
+	return vo, true
+}
+
+// structField returns the field of the struct vo, or of the struct it points to, for the property k
+func structField(vo reflect.Value, k string) (reflect.Value, bool) {
+	for vo.Kind() == reflect.Ptr || vo.Kind() == reflect.Interface {
+		if vo.IsNil() {
+			return vo, false
+		}
+		vo = vo.Elem()
+	}
+	if vo.Kind() != reflect.Struct {
+		return vo, false
+	}
+	for i := 0; i < vo.NumField(); i++ {
+		if sf := vo.Type().Field(i); fieldKey(sf) == k || sf.Name == strcase.ToCamel(k) {
+			return vo.Field(i), true
+		}
+	}
+	return vo, false
+}
+
+// pointerTokens splits a discriminator given as a JSON pointer, such as "/meta/kind", into the properties leading
+// to it. ok is false for plain property names
+func pointerTokens(dk string) (tokens []string, ok bool) {
+	if !strings.HasPrefix(dk, "/") {
+		return nil, false
+	}
+	tokens = strings.Split(dk[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, true
+}
+
+// lookupDiscriminator returns the value of the discriminator dk of the object o. dk is either the name of a property
+// of o or a JSON pointer to a property of an object nested in o
+func lookupDiscriminator(o map[string]interface{}, dk string) (interface{}, bool) {
+	tokens, ok := pointerTokens(dk)
+	if !ok {
+		v, ok := o[dk]
+		return v, ok
+	}
+	var v interface{} = o
+	for _, t := range tokens {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			if v, ok = c[t]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// withoutPointer returns a copy of v without the property the JSON pointer tokens point to. Only the objects and
+// arrays on the way to it are copied
+func withoutPointer(v interface{}, tokens []string) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		e, ok := c[tokens[0]]
+		if !ok {
+			return v
+		}
+		r := make(map[string]interface{}, len(c))
+		for k, e := range c {
+			r[k] = e
+		}
+		if len(tokens) == 1 {
+			delete(r, tokens[0])
+		} else {
+			r[tokens[0]] = withoutPointer(e, tokens[1:])
+		}
+		return r
+	case []interface{}:
+		i, err := strconv.Atoi(tokens[0])
+		if err != nil || i < 0 || i >= len(c) || len(tokens) == 1 {
+			return v
+		}
+		r := append([]interface{}(nil), c...)
+		r[i] = withoutPointer(c[i], tokens[1:])
+		return r
+	}
+	return v
+}
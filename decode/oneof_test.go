@@ -0,0 +1,761 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+type Walker struct {
+	Type  *string
+	Name  *string
+	Leash interface{}
+}
+
+func (r Walker) Discriminator() string {
+	return "type"
+}
+
+func NewWalker() interface{} {
+	_d := "walker"
+	return &Walker{Type: &_d}
+}
+
+type Leash struct {
+	Kind   *string
+	Type   *string
+	Length *int
+}
+
+func (r Leash) Discriminator() string {
+	return "kind"
+}
+
+func NewLeash() interface{} {
+	_d := "leash"
+	return &Leash{Kind: &_d}
+}
+
+// Untyped has no Discriminator method
+type Untyped struct {
+	Type *string
+}
+
+func NewUntyped() interface{} {
+	return &Untyped{}
+}
+
+// Hidden keeps its discriminator in an unexported field
+type Hidden struct {
+	kind string
+	Name *string `json:"name"`
+}
+
+func (h Hidden) Discriminator() string {
+	return "kind"
+}
+
+func NewHidden() interface{} {
+	return &Hidden{kind: "hidden"}
+}
+
+func WalkFactory(kind string) (interface{}, error) {
+	fm := map[string]func() interface{}{
+		"walker":  NewWalker,
+		"leash":   NewLeash,
+		"untyped": NewUntyped,
+	}
+	f, ok := fm[kind]
+	if !ok {
+		return nil, fmt.Errorf("cannot find type %s", kind)
+	}
+	return f(), nil
+}
+
+func TestDiscriminatorDetection(t *testing.T) {
+	amy, two, leash, walker, nylon := "amy", 2, "leash", "walker", "nylon"
+	expected := &Walker{Type: &walker, Name: &amy, Leash: &Leash{Kind: &leash, Type: &nylon, Length: &two}}
+
+	Convey("Decode detects the discriminator of every object", t, func() {
+		m := map[string]interface{}{
+			"type":  "walker",
+			"name":  "amy",
+			"leash": map[string]interface{}{"kind": "leash", "type": "nylon", "length": 2},
+		}
+		r, err := decode.Decode(m, "", WalkFactory)
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, expected)
+	})
+
+	Convey("Decode detects the discriminator of objects without the given one", t, func() {
+		m := map[string]interface{}{
+			"type":  "walker",
+			"name":  "amy",
+			"leash": map[string]interface{}{"kind": "leash", "length": 2},
+		}
+		r, err := decode.Decode(m, "type", WalkFactory)
+		So(err, ShouldBeNil)
+		So(r.(*Walker).Leash, ShouldResemble, &Leash{Kind: &leash, Length: &two})
+	})
+
+	Convey("Detection fails without a single matching property", t, func() {
+		_, err := decode.Decode(map[string]interface{}{"name": "amy"}, "", WalkFactory)
+		So(err, ShouldNotBeNil)
+		_, err = decode.Decode(map[string]interface{}{"type": "untyped"}, "", WalkFactory)
+		So(err, ShouldNotBeNil)
+		_, err = decode.Decode(map[string]interface{}{"type": "walker", "kind": "leash"}, "", WalkFactory)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "ambiguous")
+	})
+
+	Convey("DiscriminatorFactory picks constructors by their own discriminator property", t, func() {
+		type Walk struct {
+			With interface{} `json:"with"`
+		}
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "Walk.with" {
+				return decode.DiscriminatorFactory(path, NewWalker, NewLeash), nil
+			}
+			return nil, nil
+		}
+		w := &Walk{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "with": { "kind": "leash", "type": "nylon" } }`), w, pf)
+		So(err, ShouldBeNil)
+		So(w.With, ShouldResemble, &Leash{Kind: &leash, Type: &nylon})
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "with": { "type": "walker", "name": "amy" } }`), w, pf)
+		So(err, ShouldBeNil)
+		So(w.With, ShouldResemble, &Walker{Type: &walker, Name: &amy})
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "with": { "type": "leash" } }`), w, pf)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("DiscriminatorFactory requires Discriminated constructors", t, func() {
+		_, err := decode.DiscriminatorFactory("Walk.with", NewWalker, NewUntyped)(map[string]interface{}{"type": "walker"})
+		So(err, ShouldNotBeNil)
+		_, err = decode.DiscriminatorFactory("Walk.with", func() interface{} { return &Walker{} })(map[string]interface{}{})
+		So(err, ShouldNotBeNil)
+		_, err = decode.DiscriminatorFactory("Walk.with", NewRecord)(map[string]interface{}{})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Constructors setting the same discriminator value are rejected", t, func() {
+		_, err := decode.DiscriminatorFactory("Walk.with", NewWalker, NewLeash, NewWalker)(map[string]interface{}{"type": "walker"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "registered twice")
+	})
+
+	Convey("Constructors with an unexported discriminator field are rejected", t, func() {
+		_, err := decode.DiscriminatorFactory("Walk.with", NewWalker, NewHidden)(map[string]interface{}{"type": "walker"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unexported field for its discriminator property 'kind'")
+		err = decode.VerifyConstructors("Walk.with", map[string]func() interface{}{"hidden": NewHidden}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"Walk.with(hidden)"})
+	})
+}
+
+func TestQualifiedKinds(t *testing.T) {
+	Convey("QualifiedKind builds the keys of a generated TypeFactory", t, func() {
+		So(decode.QualifiedKind("Accommodation.class", "type", "BARK"), ShouldEqual, "Accommodation.class(type=BARK)")
+		So(decode.QualifiedKind("", "type", "Cat"), ShouldEqual, "Cat")
+	})
+
+	Convey("DecodeQualifiedInto resolves the same discriminator value by the field holding it", t, func() {
+		b := `{ "name": "john",
+			"owns": [{ "class": { "type": "BARK", "rooms": 1 } }],
+			"favorite": { "type": "Dog", "sound": { "type": "BARK", "volume": 11 } } }`
+		var m map[string]interface{}
+		So(json.Unmarshal([]byte(b), &m), ShouldBeNil)
+
+		r, err := decode.DecodeQualifiedInto(m, &PetOwner{}, "type", TypeFactory)
+		So(err, ShouldBeNil)
+		po := r.(*PetOwner)
+		So((*po.Owns)[0].Class, ShouldHaveSameTypeAs, &Kennel{})
+		So(po.Favorite, ShouldHaveSameTypeAs, &Dog{})
+		So(po.Favorite.(*Dog).Sound, ShouldHaveSameTypeAs, &Bark{})
+		So(*po.Favorite.(*Dog).Sound.(*Bark).Volume, ShouldEqual, 11)
+	})
+
+	Convey("DecodeQualified decodes an object found at a path", t, func() {
+		m := map[string]interface{}{"type": "Cat", "sound": map[string]interface{}{"type": "LOUD"}}
+		r, err := decode.DecodeQualified(m, "PetOwner.favorite", "type", TypeFactory)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Cat{})
+		So(r.(*Cat).Sound, ShouldHaveSameTypeAs, &Meow{})
+
+		_, err = decode.DecodeQualified(m, "PetOwner.livesIn", "type", TypeFactory)
+		So(err, ShouldNotBeNil)
+		_, err = decode.DecodeQualified(map[string]interface{}{"type": "Cat", "sound": map[string]interface{}{"type": "BARK"}},
+			"PetOwner.favorite", "type", TypeFactory)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A PathFactory still makes the objects of non-interface fields it has a factory for", t, func() {
+		title := "made"
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "Purr.heritage" {
+				return func(map[string]interface{}) (interface{}, error) {
+					return &Accommodation{Title: &title}, nil
+				}, nil
+			}
+			return SchemaPathFactory(path)
+		}
+		m := map[string]interface{}{"type": "PURR", "heritage": map[string]interface{}{"class": map[string]interface{}{"type": "BARK"}}}
+		r, err := decode.DecodeInto(m, &Purr{}, pf)
+		So(err, ShouldBeNil)
+		h := r.(*Purr).Heritage
+		So(h, ShouldNotBeNil)
+		So(*h.Title, ShouldEqual, "made")
+		So(h.Class, ShouldHaveSameTypeAs, &Kennel{})
+	})
+
+	Convey("DecodeQualified keys a root object by its bare discriminator value", t, func() {
+		r, err := decode.DecodeQualified(map[string]interface{}{"type": "walker", "name": "amy"}, "", "type", WalkFactory)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Walker{})
+	})
+}
+
+type Gear struct {
+	Kind  *int
+	Label *string
+}
+
+func (r Gear) Discriminator() string {
+	return "kind"
+}
+
+type Lamp struct {
+	Lit   *bool
+	Label *string
+}
+
+func (r Lamp) Discriminator() string {
+	return "lit"
+}
+
+func TestNonStringDiscriminators(t *testing.T) {
+	three, lit := 3, true
+
+	Convey("Decode passes numbers and booleans to the factory as strings", t, func() {
+		f := func(kind string) (interface{}, error) {
+			switch kind {
+			case "3":
+				return &Gear{}, nil
+			case "true":
+				return &Lamp{}, nil
+			}
+			return nil, fmt.Errorf("cannot find type %s", kind)
+		}
+		r, err := decode.Decode(map[string]interface{}{"kind": 3.0, "label": "a"}, "kind", f)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Gear{})
+
+		r, err = decode.Decode(map[string]interface{}{"kind": json.Number("3")}, "kind", f)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Gear{})
+
+		r, err = decode.Decode(map[string]interface{}{"lit": true}, "", f)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Lamp{})
+
+		_, err = decode.Decode(map[string]interface{}{"kind": 3.5}, "kind", f)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("NewOneOfFactory matches numbers by value", t, func() {
+		f := decode.NewOneOfFactory("Box.content", "kind", map[string]func() interface{}{
+			"3":    func() interface{} { return &Gear{} },
+			"1.50": func() interface{} { return &Lamp{} },
+			"true": func() interface{} { return &Walker{} },
+		})
+		for _, v := range []interface{}{3, 3.0, int64(3), json.Number("3.0"), "3"} {
+			r, err := f(map[string]interface{}{"kind": v})
+			So(err, ShouldBeNil)
+			So(r, ShouldHaveSameTypeAs, &Gear{})
+		}
+		r, err := f(map[string]interface{}{"kind": 1.5})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Lamp{})
+		r, err = f(map[string]interface{}{"kind": true})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Walker{})
+
+		_, err = f(map[string]interface{}{"kind": "1.5"})
+		So(err, ShouldNotBeNil)
+		_, err = f(map[string]interface{}{"kind": false})
+		So(err, ShouldNotBeNil)
+		_, err = f(map[string]interface{}{"kind": []interface{}{3}})
+		So(err, ShouldNotBeNil)
+		_, err = f(map[string]interface{}{})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("DiscriminatorFactory matches the number and boolean values set by constructors", t, func() {
+		f := decode.DiscriminatorFactory("Box.content",
+			func() interface{} { return &Gear{Kind: &three} },
+			func() interface{} { return &Lamp{Lit: &lit} })
+		type Box struct {
+			Content interface{}
+		}
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "Box.content" {
+				return f, nil
+			}
+			return nil, nil
+		}
+		b := &Box{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "content": { "kind": 3.0, "label": "cog" } }`), b, pf)
+		So(err, ShouldBeNil)
+		So(*b.Content.(*Gear).Kind, ShouldEqual, 3)
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "content": { "lit": true } }`), b, pf)
+		So(err, ShouldBeNil)
+		So(b.Content, ShouldResemble, &Lamp{Lit: &lit})
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "content": { "lit": false } }`), b, pf)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestInferFactory(t *testing.T) {
+	f := decode.InferFactory("Accommodation.class", SchemaPathFactory, NewShack, NewHouse, NewPalace)
+	pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if path == "Accommodation.class" {
+			return f, nil
+		}
+		return SchemaPathFactory(path)
+	}
+
+	Convey("InferFactory makes the only type an object matches", t, func() {
+		a := &Accommodation{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "class": { "name": "home", "rooms": 3 } }`), a, pf)
+		So(err, ShouldBeNil)
+		So(a.Class, ShouldHaveSameTypeAs, &House{})
+		So(*a.Class.(*House).Rooms, ShouldEqual, 3)
+
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "class": { "material": "tin" } }`), a, pf)
+		So(err, ShouldBeNil)
+		So(a.Class, ShouldHaveSameTypeAs, &Shack{})
+	})
+
+	Convey("InferFactory reports why every type was rejected", t, func() {
+		_, err := f(map[string]interface{}{"name": 3.0, "rooms": 2.5})
+		So(err, ShouldNotBeNil)
+		ie, ok := err.(*decode.InferenceError)
+		So(ok, ShouldBeTrue)
+		So(ie.Matched, ShouldBeEmpty)
+		So(ie.Rejected, ShouldHaveLength, 3)
+		So(errorPaths(ie.Rejected["House"]), ShouldResemble, []string{"name", "rooms"})
+		So(errorPaths(ie.Rejected["Shack"]), ShouldResemble, []string{"name", "rooms"})
+		So(err.Error(), ShouldContainSubstring, "House (")
+		So(err.Error(), ShouldContainSubstring, "Unknown property 'rooms'")
+	})
+
+	Convey("InferFactory fails when more than one type matches", t, func() {
+		_, err := decode.InferFactory("Accommodation.class", nil, NewHouse, NewKennel)(map[string]interface{}{"rooms": 1.0})
+		So(err, ShouldNotBeNil)
+		So(err.(*decode.InferenceError).Matched, ShouldResemble, []string{"House", "Kennel"})
+	})
+}
+
+func TestShapeFactory(t *testing.T) {
+	f := decode.ShapeFactory("Cat.sound",
+		decode.Shape{Present: []string{"severity"}, New: func() interface{} { return &Growl{} }},
+		decode.Shape{Match: map[string]func(interface{}) bool{"squeel": decode.Equals("high")}, New: NewMeow},
+		decode.Shape{Present: []string{"heritage"}, Absent: []string{"squeel"}, New: NewPurr},
+	)
+
+	Convey("ShapeFactory makes the first type whose shape an object has", t, func() {
+		r, err := f(map[string]interface{}{"severity": "low", "squeel": "high"})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Growl{})
+
+		r, err = f(map[string]interface{}{"squeel": "high"})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Meow{})
+
+		r, err = f(map[string]interface{}{"heritage": map[string]interface{}{}})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Purr{})
+	})
+
+	Convey("ShapeFactory fails when an object has no known shape", t, func() {
+		_, err := f(map[string]interface{}{"squeel": "low"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "[squeel]")
+		_, err = f(map[string]interface{}{"heritage": map[string]interface{}{}, "squeel": "low"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("ShapeFactory can be used as the factory of a OneOf field", t, func() {
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "Cat.sound" {
+				return f, nil
+			}
+			return SchemaPathFactory(path)
+		}
+		c := &Cat{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "sound": { "severity": "high" } }`), c, pf)
+		So(err, ShouldBeNil)
+		So(c.Sound, ShouldHaveSameTypeAs, &Growl{})
+	})
+
+	Convey("Equals compares numbers by value", t, func() {
+		So(decode.Equals(3)(3.0), ShouldBeTrue)
+		So(decode.Equals(3)("3"), ShouldBeFalse)
+		So(decode.Equals(true)(true), ShouldBeTrue)
+		So(decode.Equals(true)("true"), ShouldBeFalse)
+		So(decode.Equals([]interface{}{"a"})([]interface{}{"a"}), ShouldBeTrue)
+	})
+}
+
+type Meta struct {
+	Kind *string `json:"kind"`
+	Tag  *string `json:"tag"`
+}
+
+type Parcel struct {
+	Meta   *Meta `json:"meta"`
+	Weight *int  `json:"weight"`
+}
+
+func (r Parcel) Discriminator() string {
+	return "/meta/kind"
+}
+
+type SealedMeta struct {
+	Kind *string `json:"kind"`
+	Seal *string `json:"seal" required:"true"`
+}
+
+type Crate struct {
+	Meta *SealedMeta `json:"meta"`
+}
+
+func NewParcel() interface{} {
+	_d := "parcel"
+	return &Parcel{Meta: &Meta{Kind: &_d}}
+}
+
+func TestNestedDiscriminators(t *testing.T) {
+	parcel := "parcel"
+	m := map[string]interface{}{
+		"meta":   map[string]interface{}{"kind": "parcel", "tag": "x"},
+		"weight": 3,
+	}
+
+	Convey("Decode finds a discriminator given as a JSON pointer", t, func() {
+		f := func(kind string) (interface{}, error) {
+			if kind == "parcel" {
+				return &Parcel{}, nil
+			}
+			return nil, fmt.Errorf("cannot find type %s", kind)
+		}
+		r, err := decode.Decode(m, "/meta/kind", f)
+		So(err, ShouldBeNil)
+		So(*r.(*Parcel).Weight, ShouldEqual, 3)
+		So(*r.(*Parcel).Meta.Tag, ShouldEqual, "x")
+		So(r.(*Parcel).Meta.Kind, ShouldBeNil)
+		So(m["meta"], ShouldResemble, map[string]interface{}{"kind": "parcel", "tag": "x"})
+
+		_, err = decode.Decode(map[string]interface{}{"meta": "parcel"}, "/meta/kind", f)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Decode checks the objects holding a nested discriminator", t, func() {
+		f := func(kind string) (interface{}, error) {
+			if kind == "crate" {
+				return &Crate{}, nil
+			}
+			return nil, fmt.Errorf("cannot find type %s", kind)
+		}
+		r, err := decode.Decode(map[string]interface{}{"meta": map[string]interface{}{"kind": "crate"}}, "/meta/kind", f)
+		So(errorPaths(err), ShouldResemble, []string{"meta.seal"})
+		So(r, ShouldHaveSameTypeAs, &Crate{})
+
+		r, err = decode.Decode(map[string]interface{}{"meta": map[string]interface{}{"kind": "crate", "seal": "red"}}, "/meta/kind", f)
+		So(err, ShouldBeNil)
+		So(*r.(*Crate).Meta.Seal, ShouldEqual, "red")
+	})
+
+	Convey("NewOneOfFactory finds a discriminator given as a JSON pointer", t, func() {
+		f := decode.NewOneOfFactory("Box.content", "/meta/kind", map[string]func() interface{}{"parcel": NewParcel})
+		r, err := f(m)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Parcel{})
+
+		_, err = f(map[string]interface{}{"kind": "parcel"})
+		So(err, ShouldNotBeNil)
+
+		f = decode.NewOneOfFactory("Box.content", "/tags/1/a~1b", map[string]func() interface{}{"parcel": NewParcel})
+		_, err = f(map[string]interface{}{"tags": []interface{}{"x", map[string]interface{}{"a/b": "parcel"}}})
+		So(err, ShouldBeNil)
+		_, err = f(map[string]interface{}{"tags": []interface{}{"x"}})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("DiscriminatorFactory follows a JSON pointer returned by Discriminator", t, func() {
+		type Box struct {
+			Content interface{}
+		}
+		pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+			if path == "Box.content" {
+				return decode.DiscriminatorFactory(path, NewParcel, NewLeash), nil
+			}
+			return nil, nil
+		}
+		b := &Box{}
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "content": { "meta": { "kind": "parcel", "tag": "x" }, "weight": 2 } }`), b, pf)
+		So(err, ShouldBeNil)
+		So(b.Content.(*Parcel).Meta.Kind, ShouldResemble, &parcel)
+		So(*b.Content.(*Parcel).Weight, ShouldEqual, 2)
+	})
+}
+
+func TestTagging(t *testing.T) {
+	cat, dog, happy, dachshund := "Cat", "Dog", "happy", "dachshund"
+	external := decode.Options{Tagging: map[string]decode.Tagging{
+		"PetOwner.favorite": {Style: decode.ExternallyTagged},
+	}}
+	adjacent := decode.Options{Tagging: map[string]decode.Tagging{
+		"PetOwner.favorite": {Style: decode.AdjacentlyTagged},
+		"PetOwner.livesIn":  {Style: decode.AdjacentlyTagged, Tag: "kind", Content: "data", Discriminator: "type"},
+	}}
+
+	Convey("Externally tagged objects are resolved by the field's factory", t, func() {
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "Cat": { "mood": "happy" } } }`), po, SchemaPathFactory, external)
+		So(err, ShouldBeNil)
+		So(po.Favorite, ShouldResemble, &Cat{Type: &cat, Mood: &happy})
+
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "Cat": {}, "Dog": {} } }`), po, SchemaPathFactory, external)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "Cat": "tom" } }`), po, SchemaPathFactory, external)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "type": "Cat" } }`), po, SchemaPathFactory, external)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Adjacently tagged objects are resolved by the field's factory", t, func() {
+		po := &PetOwner{}
+		b := `{ "favorite": { "type": "Dog", "value": { "kind": "dachshund" } }, "livesIn": { "kind": "House" } }`
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(b), po, SchemaPathFactory, adjacent)
+		So(err, ShouldBeNil)
+		So(po.Favorite, ShouldResemble, &Dog{Type: &dog, Kind: &dachshund})
+		So(po.LivesIn, ShouldHaveSameTypeAs, &House{})
+
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "value": {} } }`), po, SchemaPathFactory, adjacent)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "type": "Dog", "kind": "x" } }`), po, SchemaPathFactory, adjacent)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("The content of tagged objects is decoded like internally tagged objects", t, func() {
+		_, err := decode.DecodeIntoWithOptions(map[string]interface{}{
+			"favorite": map[string]interface{}{"type": "Dog", "value": map[string]interface{}{"kind": []interface{}{}}},
+		}, &PetOwner{}, SchemaPathFactory, adjacent)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUnknownFallback(t *testing.T) {
+	pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		switch path {
+		case "PetOwner.favorite":
+			return decode.NewOneOfFactory(path, "type", map[string]func() interface{}{"Cat": NewCat, "Dog": NewDog}), nil
+		case "PetOwner.livesIn":
+			return decode.DiscriminatorFactory(path, NewHouse, NewPalace), nil
+		}
+		return SchemaPathFactory(path)
+	}
+	b := []byte(`{ "name": "john", "favorite": { "type": "Parrot", "words": 12 }, "livesIn": { "type": "Igloo" } }`)
+
+	Convey("Unknown discriminator values fail by default", t, func() {
+		_, err := decode.UnmarshalJSONInto(b, &PetOwner{}, pf)
+		So(err, ShouldNotBeNil)
+		ue, ok := err.(*decode.UnknownDiscriminatorError)
+		So(ok, ShouldBeTrue)
+		So(ue.Path, ShouldEqual, "PetOwner.favorite")
+		So(ue.Value, ShouldEqual, "Parrot")
+	})
+
+	Convey("UnknownFallback keeps unknown objects and reports them", t, func() {
+		var diagnosed []string
+		opts := decode.Options{
+			UnknownFallback: true,
+			Diagnostics: func(path string, err error) {
+				diagnosed = append(diagnosed, path+": "+err.Error())
+			},
+		}
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONIntoWithOptions(b, po, pf, opts)
+		So(err, ShouldBeNil)
+		So(*po.Name, ShouldEqual, "john")
+		So(po.Favorite, ShouldResemble, &decode.Unknown{
+			Property: "type",
+			Value:    "Parrot",
+			Raw:      map[string]interface{}{"type": "Parrot", "words": 12.0},
+		})
+		So(po.LivesIn.(*decode.Unknown).Value, ShouldEqual, "Igloo")
+		So(diagnosed, ShouldResemble, []string{
+			"favorite: Unknown discriminator value 'Parrot' when handling OneOf field 'PetOwner.favorite'",
+			"livesIn: Unknown discriminator value 'Igloo' when handling OneOf field 'PetOwner.livesIn'",
+		})
+	})
+
+	Convey("UnknownFallback does not hide other factory errors", t, func() {
+		opts := decode.Options{UnknownFallback: true}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "name": "polly" } }`), &PetOwner{}, pf, opts)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "type": 7 } }`), &PetOwner{}, SchemaPathFactory, opts)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Unknown keeps tagged objects as found in the payload", t, func() {
+		opts := decode.Options{
+			UnknownFallback: true,
+			Tagging:         map[string]decode.Tagging{"PetOwner.favorite": {Style: decode.ExternallyTagged}},
+		}
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "favorite": { "Parrot": { "words": 12 } } }`), po, pf, opts)
+		So(err, ShouldBeNil)
+		So(po.Favorite, ShouldResemble, &decode.Unknown{
+			Property: "type",
+			Value:    "Parrot",
+			Raw:      map[string]interface{}{"Parrot": map[string]interface{}{"words": 12.0}},
+		})
+	})
+
+	Convey("UnknownFallback applies to generated factories", t, func() {
+		po := &PetOwner{}
+		b := []byte(`{ "favorite": { "name": "polly", "type": "Parrot" } }`)
+		_, err := decode.UnmarshalJSONIntoWithOptions(b, po, SchemaPathFactory, decode.Options{UnknownFallback: true})
+		So(err, ShouldBeNil)
+		So(po.Favorite, ShouldResemble, &decode.Unknown{
+			Property: "type",
+			Value:    "Parrot",
+			Raw:      map[string]interface{}{"name": "polly", "type": "Parrot"},
+		})
+
+		_, err = decode.UnmarshalJSONInto(b, &PetOwner{}, SchemaPathFactory)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type CreatedV1 struct {
+	Type          *string `json:"type"`
+	SchemaVersion *int    `json:"schemaVersion"`
+	Name          *string `json:"name"`
+}
+
+type CreatedV2 struct {
+	Type          *string `json:"type"`
+	SchemaVersion *int    `json:"schemaVersion"`
+	FullName      *string `json:"fullName"`
+}
+
+func TestCompoundDiscriminators(t *testing.T) {
+	events := map[string]func() interface{}{
+		decode.CompoundKind("created", "1"): func() interface{} { return &CreatedV1{} },
+		decode.CompoundKind("created", "2"): func() interface{} { return &CreatedV2{} },
+	}
+	f := func(kind string) (interface{}, error) {
+		if ctor, ok := events[kind]; ok {
+			return ctor(), nil
+		}
+		return nil, fmt.Errorf("cannot find type %s", kind)
+	}
+
+	Convey("DecodeCompound picks the type from every discriminator", t, func() {
+		r, err := decode.DecodeCompound(map[string]interface{}{"type": "created", "schemaVersion": 1.0, "name": "a"},
+			[]string{"type", "schemaVersion"}, f)
+		So(err, ShouldBeNil)
+		So(*r.(*CreatedV1).Name, ShouldEqual, "a")
+
+		r, err = decode.DecodeCompound(map[string]interface{}{"type": "created", "schemaVersion": 2, "fullName": "a b"},
+			[]string{"type", "schemaVersion"}, f)
+		So(err, ShouldBeNil)
+		So(*r.(*CreatedV2).FullName, ShouldEqual, "a b")
+
+		_, err = decode.DecodeCompound(map[string]interface{}{"type": "created"}, []string{"type", "schemaVersion"}, f)
+		So(err, ShouldNotBeNil)
+		_, err = decode.DecodeCompound(map[string]interface{}{"type": "created", "schemaVersion": 3},
+			[]string{"type", "schemaVersion"}, f)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("CompoundFactory picks the constructor from every discriminator", t, func() {
+		cf := decode.CompoundFactory("Event.body", []string{"type", "schemaVersion"}, events)
+		r, err := cf(map[string]interface{}{"type": "created", "schemaVersion": json.Number("2")})
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &CreatedV2{})
+
+		_, err = cf(map[string]interface{}{"type": "created", "schemaVersion": 3})
+		So(err, ShouldNotBeNil)
+		ue, ok := err.(*decode.UnknownDiscriminatorError)
+		So(ok, ShouldBeTrue)
+		So(ue.Value, ShouldEqual, "created|3")
+
+		_, err = cf(map[string]interface{}{"schemaVersion": 3})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRootPath(t *testing.T) {
+	cat := "Cat"
+	pf := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if path == "Pet" {
+			return decode.NewOneOfFactory(path, "type", map[string]func() interface{}{"Cat": NewCat, "Dog": NewDog}), nil
+		}
+		return SchemaPathFactory(path)
+	}
+
+	Convey("A document is decoded into the object made by the factory of its root path", t, func() {
+		r, err := decode.UnmarshalJSONInto([]byte(`{ "type": "Cat", "mood": "happy", "sound": { "type": "PURR" } }`),
+			decode.RootPath("PetOwner.favorite"), SchemaPathFactory)
+		So(err, ShouldBeNil)
+		c, ok := r.(*Cat)
+		So(ok, ShouldBeTrue)
+		So(c.Type, ShouldResemble, &cat)
+		So(c.Sound, ShouldHaveSameTypeAs, &Purr{})
+
+		r, err = decode.DecodeInto(map[string]interface{}{"type": "Dog"}, decode.RootPath("Pet"), pf)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Dog{})
+	})
+
+	Convey("Root paths use the options of their path", t, func() {
+		opts := decode.Options{
+			Tagging:         map[string]decode.Tagging{"Pet": {Style: decode.ExternallyTagged}},
+			UnknownFallback: true,
+		}
+		r, err := decode.UnmarshalJSONIntoWithOptions([]byte(`{ "Cat": { "mood": "happy" } }`), decode.RootPath("Pet"), pf, opts)
+		So(err, ShouldBeNil)
+		So(r, ShouldHaveSameTypeAs, &Cat{})
+
+		r, err = decode.UnmarshalJSONIntoWithOptions([]byte(`{ "Cow": {} }`), decode.RootPath("Pet"), pf, opts)
+		So(err, ShouldBeNil)
+		So(r.(*decode.Unknown).Value, ShouldEqual, "Cow")
+
+		err = decode.Validate([]byte(`{ "type": "House", "rooms": "many" }`), decode.RootPath("PetOwner.livesIn"), SchemaPathFactory)
+		So(errorPaths(err), ShouldResemble, []string{"rooms"})
+	})
+
+	Convey("Root paths need a factory", t, func() {
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "type": "Cat" }`), decode.RootPath("Pet"), nil)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "type": "Cat" }`), decode.RootPath("Nowhere"), SchemaPathFactory)
+		So(err, ShouldNotBeNil)
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "type": "Cow" }`), decode.RootPath("Pet"), pf)
+		So(err, ShouldNotBeNil)
+	})
+}
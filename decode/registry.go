@@ -0,0 +1,173 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry collects the types of OneOf fields and makes the factories decoding them, in place of generated
+// SchemaPathFactory, per path factories and TypeFactory functions. It is safe for concurrent use. The PathFactory and
+// Factory it made see the types registered afterwards, but a OneOfFactory only knows the types of its field
+// registered when it was made
+type Registry struct {
+	lock  sync.RWMutex
+	paths map[string]*registeredPath
+	// kinds holds every constructor by its QualifiedKind
+	kinds map[string]func() interface{}
+	// factories caches the OneOfFactory of every field until a type is registered for it
+	factories map[string]OneOfFactory
+}
+
+// registeredPath holds the types of a OneOf field
+type registeredPath struct {
+	// dks are the discriminator properties, more than one for compound discriminators
+	dks   []string
+	ctors map[string]func() interface{}
+}
+
+// constructors returns a copy of the constructors of the field, by discriminator value
+func (p *registeredPath) constructors() map[string]func() interface{} {
+	fm := make(map[string]func() interface{}, len(p.ctors))
+	for v, ctor := range p.ctors {
+		fm[v] = ctor
+	}
+	return fm
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		paths:     map[string]*registeredPath{},
+		kinds:     map[string]func() interface{}{},
+		factories: map[string]OneOfFactory{},
+	}
+}
+
+// Register makes ctor the constructor of the objects of the OneOf field at path, such as "PetOwner.favorite", whose
+// discriminator property dk has the given value. Every type of a field must use the same discriminator property,
+// and a value can only be registered once
+func (r *Registry) Register(path, dk, value string, ctor func() interface{}) error {
+	return r.register(path, []string{dk}, value, ctor)
+}
+
+// RegisterCompound is Register for a field whose types are identified by the values of several discriminator
+// properties, as with CompoundFactory
+func (r *Registry) RegisterCompound(path string, dks []string, values []string, ctor func() interface{}) error {
+	if len(dks) != len(values) {
+		return fmt.Errorf("OneOf field '%s' has %d discriminator properties but %d values were given", path, len(dks), len(values))
+	}
+	return r.register(path, dks, CompoundKind(values...), ctor)
+}
+
+func (r *Registry) register(path string, dks []string, value string, ctor func() interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.paths[path]
+	if !ok {
+		p = &registeredPath{dks: dks, ctors: map[string]func() interface{}{}}
+		r.paths[path] = p
+	}
+	if CompoundKind(p.dks...) != CompoundKind(dks...) {
+		return fmt.Errorf("OneOf field '%s' is discriminated by %v, not %v", path, p.dks, dks)
+	}
+	if _, ok := p.ctors[value]; ok {
+		return fmt.Errorf("discriminator value '%s' is already registered for OneOf field '%s'", value, path)
+	}
+	p.ctors[value] = ctor
+	r.kinds[QualifiedKind(path, CompoundKind(dks...), value)] = ctor
+	delete(r.factories, path)
+	return nil
+}
+
+// OneOfFactory returns the factory of the OneOf field at path, or nil if no type is registered for it. The factory
+// only knows the types registered so far
+func (r *Registry) OneOfFactory(path string) OneOfFactory {
+	r.lock.RLock()
+	f, ok := r.factories[path]
+	r.lock.RUnlock()
+	if ok {
+		return f
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if f, ok = r.factories[path]; ok {
+		return f
+	}
+	p, ok := r.paths[path]
+	if !ok {
+		return nil
+	}
+	fm := p.constructors()
+	if len(p.dks) > 1 {
+		f = CompoundFactory(path, p.dks, fm)
+	} else {
+		f = NewOneOfFactory(path, p.dks[0], fm)
+	}
+	r.factories[path] = f
+	return f
+}
+
+// PathFactory returns a PathFactory resolving every registered OneOf field
+func (r *Registry) PathFactory() PathFactory {
+	return func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if f := r.OneOfFactory(path); f != nil {
+			return f, nil
+		}
+		return nil, nil
+	}
+}
+
+// Factory returns a Factory making the registered types by their QualifiedKind, such as
+// "Accommodation.class(type=BARK)", for DecodeQualified
+func (r *Registry) Factory() Factory {
+	return func(kind string) (interface{}, error) {
+		r.lock.RLock()
+		ctor, ok := r.kinds[kind]
+		r.lock.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("cannot find type %s", kind)
+		}
+		return ctor(), nil
+	}
+}
+
+// Paths returns the registered OneOf fields, in order
+func (r *Registry) Paths() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	paths := make([]string, 0, len(r.paths))
+	for path := range r.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Verify checks the constructors of every field with VerifyConstructors. Fields with compound discriminators are
+// skipped, as their constructors' values cannot be compared with a single discriminator
+func (r *Registry) Verify() error {
+	var errs Errors
+	for _, path := range r.Paths() {
+		r.lock.RLock()
+		p := r.paths[path]
+		compound, ctors := len(p.dks) > 1, p.constructors()
+		r.lock.RUnlock()
+		if compound {
+			continue
+		}
+		if err := VerifyConstructors(path, ctors, nil); err != nil {
+			errs = append(errs, err.(Errors)...)
+		}
+	}
+	return errs.errOrNil()
+}
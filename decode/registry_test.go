@@ -0,0 +1,136 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+// petsRegistry registers the types of decode_pets_gen_test.go
+func petsRegistry() *decode.Registry {
+	r := decode.NewRegistry()
+	for _, t := range []struct {
+		path, value string
+		ctor        func() interface{}
+	}{
+		{"Accommodation.class", "BARK", NewKennel},
+		{"Accommodation.class", "House", NewHouse},
+		{"Accommodation.class", "Palace", NewPalace},
+		{"Accommodation.class", "Shack", NewShack},
+		{"Cat.favSound", "MEOW", NewMeow},
+		{"Cat.favSound", "PURR", NewPurr},
+		{"Cat.sound", "LOUD", NewMeow},
+		{"Cat.sound", "PURR", NewPurr},
+		{"Cat.sound", "WARN", NewGrowl},
+		{"Dog.sound", "BARK", NewBark},
+		{"PetOwner.favorite", "Cat", NewCat},
+		{"PetOwner.favorite", "Dog", NewDog},
+		{"PetOwner.livesIn", "House", NewHouse},
+		{"PetOwner.livesIn", "Palace", NewPalace},
+	} {
+		if err := r.Register(t.path, "type", t.value, t.ctor); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+func TestRegistry(t *testing.T) {
+	b := []byte(`{ "name": "john",
+		"owns": [{ "class": { "type": "BARK", "rooms": 1 } }],
+		"favorite": { "type": "Dog", "sound": { "type": "BARK", "volume": 11 } },
+		"livesIn": { "type": "Palace", "towers": 2 } }`)
+
+	Convey("The PathFactory of a registry decodes like a generated one", t, func() {
+		r := petsRegistry()
+		So(r.Paths(), ShouldHaveLength, 6)
+
+		po := &PetOwner{}
+		_, err := decode.UnmarshalJSONInto(b, po, r.PathFactory())
+		So(err, ShouldBeNil)
+		expected := &PetOwner{}
+		_, err = decode.UnmarshalJSONInto(b, expected, SchemaPathFactory)
+		So(err, ShouldBeNil)
+		So(po, ShouldResemble, expected)
+		So((*po.Owns)[0].Class, ShouldHaveSameTypeAs, &Kennel{})
+	})
+
+	Convey("The Factory of a registry is keyed by qualified kinds", t, func() {
+		f := petsRegistry().Factory()
+		o, err := f("Accommodation.class(type=BARK)")
+		So(err, ShouldBeNil)
+		So(o, ShouldHaveSameTypeAs, &Kennel{})
+		o, err = f("Dog.sound(type=BARK)")
+		So(err, ShouldBeNil)
+		So(o, ShouldHaveSameTypeAs, &Bark{})
+		_, err = f("BARK")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("OneOfFactory reports unknown paths and values", t, func() {
+		r := petsRegistry()
+		So(r.OneOfFactory("PetOwner.name"), ShouldBeNil)
+		pf, err := r.PathFactory()("PetOwner.name")
+		So(err, ShouldBeNil)
+		So(pf, ShouldBeNil)
+
+		_, err = r.OneOfFactory("PetOwner.livesIn")(map[string]interface{}{"type": "Shack"})
+		So(err, ShouldHaveSameTypeAs, &decode.UnknownDiscriminatorError{})
+		So(err.Error(), ShouldEqual, "Unknown discriminator value 'Shack' when handling OneOf field 'PetOwner.livesIn'")
+	})
+
+	Convey("PathFactory and Factory see types registered afterwards", t, func() {
+		r := petsRegistry()
+		pf := r.PathFactory()
+		f := r.Factory()
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "livesIn": { "type": "Shack" } }`), &PetOwner{}, pf)
+		So(err, ShouldNotBeNil)
+		before := r.OneOfFactory("PetOwner.livesIn")
+		So(r.Register("PetOwner.livesIn", "type", "Shack", NewShack), ShouldBeNil)
+
+		po := &PetOwner{}
+		_, err = decode.UnmarshalJSONInto([]byte(`{ "livesIn": { "type": "Shack" } }`), po, pf)
+		So(err, ShouldBeNil)
+		So(po.LivesIn, ShouldHaveSameTypeAs, &Shack{})
+		_, err = f("PetOwner.livesIn(type=Shack)")
+		So(err, ShouldBeNil)
+
+		_, err = before(map[string]interface{}{"type": "Shack"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Duplicate and inconsistent registrations are rejected", t, func() {
+		r := petsRegistry()
+		err := r.Register("Cat.sound", "type", "PURR", NewMeow)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "already registered")
+		So(r.Register("Cat.sound", "kind", "HISS", NewGrowl), ShouldNotBeNil)
+		So(r.RegisterCompound("Cat.sound", []string{"type", "v"}, []string{"HISS", "1"}, NewGrowl), ShouldNotBeNil)
+		So(r.RegisterCompound("Cat.noise", []string{"type", "v"}, []string{"HISS"}, NewGrowl), ShouldNotBeNil)
+
+		err = r.Verify()
+		So(errorPaths(err), ShouldResemble, []string{"Cat.sound(type=LOUD)"})
+	})
+
+	Convey("Registries support compound discriminators", t, func() {
+		r := decode.NewRegistry()
+		So(r.RegisterCompound("Event.body", []string{"type", "schemaVersion"}, []string{"created", "1"},
+			func() interface{} { return &CreatedV1{} }), ShouldBeNil)
+		So(r.RegisterCompound("Event.body", []string{"type", "schemaVersion"}, []string{"created", "2"},
+			func() interface{} { return &CreatedV2{} }), ShouldBeNil)
+		So(r.Register("Event.body", "type", "deleted", NewWalker), ShouldNotBeNil)
+
+		o, err := r.OneOfFactory("Event.body")(map[string]interface{}{"type": "created", "schemaVersion": 2.0})
+		So(err, ShouldBeNil)
+		So(o, ShouldHaveSameTypeAs, &CreatedV2{})
+		o, err = r.Factory()("Event.body(type|schemaVersion=created|1)")
+		So(err, ShouldBeNil)
+		So(o, ShouldHaveSameTypeAs, &CreatedV1{})
+		So(r.Verify(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,526 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/iancoleman/strcase"
+)
+
+// RequiredTagName specifies the struct tag marking a field whose property must be present in the payload
+const RequiredTagName = "required"
+
+// ErrMissingRequired is reported for every required property missing from a payload
+var ErrMissingRequired = errors.New("missing required property")
+
+var requiredLock sync.RWMutex
+
+var requiredProperties = map[reflect.Type][]string{}
+
+// RegisterRequired records the required properties of a schema, as listed by the required keyword of its OpenAPI
+// definition. o is an object, or a pointer to an object, of the type the schema is decoded into. Properties already
+// registered for the type are ignored
+func RegisterRequired(o interface{}, properties ...string) {
+	t := requiredType(o)
+	requiredLock.Lock()
+	defer requiredLock.Unlock()
+	for _, p := range properties {
+		if !containsString(requiredProperties[t], p) {
+			requiredProperties[t] = append(requiredProperties[t], p)
+		}
+	}
+}
+
+// UnregisterRequired forgets the properties registered as required for the type of o
+func UnregisterRequired(o interface{}) {
+	t := requiredType(o)
+	requiredLock.Lock()
+	defer requiredLock.Unlock()
+	delete(requiredProperties, t)
+}
+
+func requiredType(o interface{}) reflect.Type {
+	t := reflect.TypeOf(o)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func registeredRequired(t reflect.Type) []string {
+	requiredLock.RLock()
+	defer requiredLock.RUnlock()
+	return requiredProperties[t]
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequired records an error for every required property of the object at path which is missing from m
+func (d *decoder) checkRequired(m map[string]interface{}, t reflect.Type, path string) {
+	present := map[string]bool{}
+	for k := range m {
+		present[strcase.ToCamel(k)] = true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if required, _ := strconv.ParseBool(sf.Tag.Get(RequiredTagName)); required && !present[sf.Name] {
+			d.addError(joinPath(path, fieldKey(sf)), ErrMissingRequired)
+			present[sf.Name] = true
+		}
+	}
+	for _, p := range registeredRequired(t) {
+		if fn := strcase.ToCamel(p); !present[fn] {
+			d.addError(joinPath(path, p), ErrMissingRequired)
+			present[fn] = true
+		}
+	}
+}
+
+// addError records a problem found at path which does not stop decoding. The paths of FieldErrors are taken to be
+// relative to path
+func (d *decoder) addError(path string, err error) {
+	switch e := err.(type) {
+	case Errors:
+		for _, ee := range e {
+			d.addError(path, ee)
+		}
+	case *FieldError:
+		d.errs = append(d.errs, &FieldError{Path: joinPath(path, e.Path), Err: e.Err})
+	default:
+		d.errs = append(d.errs, &FieldError{Path: path, Err: err})
+	}
+}
+
+// rules are the tags stating when a field must or must not be present in the payload depending on its siblings. As
+// for required properties, a field is set if its property is present in the payload, whatever its value. Siblings
+// are named by their payload key or field name:
+//   - required_if:"type=Shack rooms>1" requires the field when every condition holds. Conditions compare a sibling to
+//     a value with one of = != > >= < <=
+//   - required_with:"name rooms" requires the field when any of the siblings is set
+//   - excluded_with:"name rooms" forbids the field when any of the siblings is set
+var rules = []struct {
+	tag   string
+	check func(o reflect.Value, present map[string]bool, set bool, arg string) error
+}{
+	{"required_if", checkRequiredIf},
+	{"required_with", checkRequiredWith},
+	{"excluded_with", checkExcludedWith},
+}
+
+// checkRules records an error for every field of the object at path which breaks one of its rules
+func (d *decoder) checkRules(m map[string]interface{}, vo reflect.Value, path string) {
+	present := map[string]bool{}
+	for k := range m {
+		present[strcase.ToCamel(k)] = true
+	}
+
+	t := vo.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		for _, r := range rules {
+			arg, ok := sf.Tag.Lookup(r.tag)
+			if !ok {
+				continue
+			}
+			if err := r.check(vo.Elem(), present, present[sf.Name], arg); err != nil {
+				d.addError(joinPath(path, fieldKey(sf)), err)
+			}
+		}
+	}
+}
+
+// sibling returns the field of o named by its payload key or field name
+func sibling(o reflect.Value, name string) (reflect.Value, error) {
+	f := o.FieldByName(strcase.ToCamel(name))
+	if !f.IsValid() {
+		return f, fmt.Errorf("unknown field '%s' in rule", name)
+	}
+	return f, nil
+}
+
+// anySet returns the first of the named siblings which is present in the payload
+func anySet(o reflect.Value, present map[string]bool, arg string) (string, error) {
+	for _, name := range strings.Fields(arg) {
+		if _, err := sibling(o, name); err != nil {
+			return "", err
+		}
+		if present[strcase.ToCamel(name)] {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func checkRequiredWith(o reflect.Value, present map[string]bool, set bool, arg string) error {
+	name, err := anySet(o, present, arg)
+	if err != nil || set || name == "" {
+		return err
+	}
+	return fmt.Errorf("required with %s", name)
+}
+
+func checkExcludedWith(o reflect.Value, present map[string]bool, set bool, arg string) error {
+	name, err := anySet(o, present, arg)
+	if err != nil || !set || name == "" {
+		return err
+	}
+	return fmt.Errorf("not allowed with %s", name)
+}
+
+func checkRequiredIf(o reflect.Value, _ map[string]bool, set bool, arg string) error {
+	if set {
+		return nil
+	}
+	for _, cond := range strings.Fields(arg) {
+		holds, err := evalCondition(o, cond)
+		if err != nil || !holds {
+			return err
+		}
+	}
+	return fmt.Errorf("required when %s", arg)
+}
+
+// operators of rule conditions, two character operators first so that they are matched before their prefixes
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// evalCondition tells if a condition such as rooms>1 holds for the sibling it names. Unset siblings fail every
+// condition
+func evalCondition(o reflect.Value, cond string) (bool, error) {
+	for _, op := range operators {
+		i := strings.Index(cond, op)
+		if i <= 0 {
+			continue
+		}
+		f, err := sibling(o, cond[:i])
+		if err != nil {
+			return false, err
+		}
+		for f.Kind() == reflect.Ptr || f.Kind() == reflect.Interface {
+			if f.IsNil() {
+				return false, nil
+			}
+			f = f.Elem()
+		}
+		return compareValue(f, op, cond[i+len(op):])
+	}
+	return false, fmt.Errorf("invalid condition '%s' in rule", cond)
+}
+
+// compareValue compares numeric fields as numbers and any other field by its text
+func compareValue(f reflect.Value, op string, arg string) (bool, error) {
+	var c int
+	if n, ok := number(f); ok {
+		a, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid number '%s' in rule", arg)
+		}
+		switch {
+		case n < a:
+			c = -1
+		case n > a:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(fmt.Sprint(f.Interface()), arg)
+	}
+
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	}
+	return c <= 0, nil
+}
+
+// Validate checks that the JSON document b can be decoded into an object of the type of target, and returns every
+// problem found rather than the first one: type mismatches, unresolvable OneOf objects, nulls and missing required
+// properties, bad defaults, broken constraints and rules, and errors from Validators. target is a struct or slice
+// pointer, as for DecodeInto, only used for its type and left untouched, or may be a RootPath
+func Validate(b []byte, target interface{}, pf PathFactory) error {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	d := &decoder{pf: pf, opts: Options{ApplyDefaults: true}, collect: true}
+	if rp, ok := target.(RootPath); ok {
+		if _, err := d.decodeRoot(m, rp); err != nil {
+			return err
+		}
+		return d.errs.errOrNil()
+	}
+
+	t := reflect.TypeOf(target)
+	if t == nil {
+		return fmt.Errorf("Target object is not a struct/slice pointer. Unsupported")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if _, err := d.decodeInto(m, reflect.New(t).Interface(), ""); err != nil {
+		return err
+	}
+	return d.errs.errOrNil()
+}
+
+// fail handles an error found at path: it is returned to stop decoding unless errors are being collected
+func (d *decoder) fail(path string, err error) error {
+	if !d.collect {
+		return err
+	}
+	d.addError(path, err)
+	return nil
+}
+
+// Validator is implemented by types checking rules of their own, such as rules across several fields
+type Validator interface {
+	Validate() error
+}
+
+// validate calls Validate on an object implementing Validator. As objects are validated once decoded, children are
+// validated before their parents
+func (d *decoder) validate(o interface{}, path string) {
+	if v, ok := o.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			d.addError(path, err)
+		}
+	}
+}
+
+// constraint checks the value of a field against the argument of its validation tag
+type constraint func(v reflect.Value, arg string) error
+
+// constraints maps validation tags, named after the OpenAPI keywords, to their checks. They are applied in this order
+var constraints = []struct {
+	tag   string
+	check constraint
+}{
+	{"minimum", checkMinimum},
+	{"maximum", checkMaximum},
+	{"minLength", checkMinLength},
+	{"maxLength", checkMaxLength},
+	{"pattern", checkPattern},
+	{"enum", checkEnum},
+	{"minItems", checkMinItems},
+	{"maxItems", checkMaxItems},
+	{"uniqueItems", checkUniqueItems},
+}
+
+// checkConstraints records an error for every field of the object at path whose value breaks one of its validation
+// tags. Fields missing from the payload are only checked if they were set from a default
+func (d *decoder) checkConstraints(vo reflect.Value, missing map[string]reflect.StructField, path string) {
+	t := vo.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		if _, ok := missing[sf.Name]; ok {
+			if _, hasDefault := d.lookupDefault(sf); !d.opts.ApplyDefaults || !hasDefault {
+				continue
+			}
+		}
+		f := vo.Elem().Field(i)
+		for f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				break
+			}
+			f = f.Elem()
+		}
+		if f.Kind() == reflect.Ptr {
+			continue
+		}
+		for _, c := range constraints {
+			arg, ok := sf.Tag.Lookup(c.tag)
+			if !ok {
+				continue
+			}
+			if err := c.check(f, arg); err != nil {
+				d.addError(joinPath(path, fieldKey(sf)), err)
+			}
+		}
+	}
+}
+
+// number returns the value of a numeric field as a float
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func compareNumber(v reflect.Value, arg string, tag string, fails func(n, limit float64) bool) error {
+	n, ok := number(v)
+	if !ok {
+		return nil
+	}
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s '%s': %s", tag, arg, err)
+	}
+	if fails(n, limit) {
+		return fmt.Errorf("value %v breaks %s %s", n, tag, arg)
+	}
+	return nil
+}
+
+func checkMinimum(v reflect.Value, arg string) error {
+	return compareNumber(v, arg, "minimum", func(n, limit float64) bool { return n < limit })
+}
+
+func checkMaximum(v reflect.Value, arg string) error {
+	return compareNumber(v, arg, "maximum", func(n, limit float64) bool { return n > limit })
+}
+
+func compareLength(n int, arg string, tag string, fails func(n, limit int) bool) error {
+	limit, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid %s '%s': %s", tag, arg, err)
+	}
+	if fails(n, limit) {
+		return fmt.Errorf("length %d breaks %s %s", n, tag, arg)
+	}
+	return nil
+}
+
+func checkMinLength(v reflect.Value, arg string) error {
+	if v.Kind() != reflect.String {
+		return nil
+	}
+	return compareLength(utf8.RuneCountInString(v.String()), arg, "minLength", func(n, limit int) bool { return n < limit })
+}
+
+func checkMaxLength(v reflect.Value, arg string) error {
+	if v.Kind() != reflect.String {
+		return nil
+	}
+	return compareLength(utf8.RuneCountInString(v.String()), arg, "maxLength", func(n, limit int) bool { return n > limit })
+}
+
+var patternsLock sync.Mutex
+
+// patterns caches the regular expressions of pattern tags
+var patterns = map[string]*regexp.Regexp{}
+
+func checkPattern(v reflect.Value, arg string) error {
+	if v.Kind() != reflect.String {
+		return nil
+	}
+	patternsLock.Lock()
+	re, ok := patterns[arg]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(arg); err != nil {
+			patternsLock.Unlock()
+			return fmt.Errorf("invalid pattern '%s': %s", arg, err)
+		}
+		patterns[arg] = re
+	}
+	patternsLock.Unlock()
+	if !re.MatchString(v.String()) {
+		return fmt.Errorf("value '%s' does not match pattern '%s'", v.String(), arg)
+	}
+	return nil
+}
+
+// checkEnum checks a string, numeric or boolean value against a comma separated list of allowed values
+func checkEnum(v reflect.Value, arg string) error {
+	var s string
+	if n, ok := number(v); ok {
+		s = strconv.FormatFloat(n, 'f', -1, 64)
+	} else if v.Kind() == reflect.String || v.Kind() == reflect.Bool {
+		s = fmt.Sprint(v.Interface())
+	} else {
+		return nil
+	}
+	for _, e := range strings.Split(arg, ",") {
+		if e == s {
+			return nil
+		}
+		if f, err := strconv.ParseFloat(e, 64); err == nil && v.Kind() != reflect.String && strconv.FormatFloat(f, 'f', -1, 64) == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("value '%s' is not one of enum %s", s, arg)
+}
+
+func items(v reflect.Value) (int, bool) {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0, false
+	}
+	return v.Len(), true
+}
+
+func checkMinItems(v reflect.Value, arg string) error {
+	n, ok := items(v)
+	if !ok {
+		return nil
+	}
+	return compareLength(n, arg, "minItems", func(n, limit int) bool { return n < limit })
+}
+
+func checkMaxItems(v reflect.Value, arg string) error {
+	n, ok := items(v)
+	if !ok {
+		return nil
+	}
+	return compareLength(n, arg, "maxItems", func(n, limit int) bool { return n > limit })
+}
+
+func checkUniqueItems(v reflect.Value, arg string) error {
+	n, ok := items(v)
+	if !ok {
+		return nil
+	}
+	unique, err := strconv.ParseBool(arg)
+	if err != nil {
+		return fmt.Errorf("invalid uniqueItems '%s': %s", arg, err)
+	}
+	if !unique {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if reflect.DeepEqual(v.Index(i).Interface(), v.Index(j).Interface()) {
+				return fmt.Errorf("items %d and %d are equal, breaking uniqueItems", i, j)
+			}
+		}
+	}
+	return nil
+}
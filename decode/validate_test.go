@@ -0,0 +1,394 @@
+// Copyright 2019 F5 Networks. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package decode_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/weberr13/go-decode/decode"
+)
+
+type RequiredPet struct {
+	Type *string `json:"type"`
+	Name *string `json:"name" required:"true"`
+	Age  *int    `json:"age"`
+}
+
+type RequiredOwner struct {
+	Name     string      `required:"true"`
+	Favorite interface{} `json:"favorite" required:"true"`
+	Pets     []RequiredPet
+	Home     *RequiredHome `json:"home"`
+}
+
+type RequiredHome struct {
+	Rooms int `json:"rooms" default:"1" required:"true"`
+}
+
+func init() {
+	decode.RegisterRequired(RequiredPet{}, "age", "type")
+}
+
+var requiredSPF = func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+	if path == "RequiredOwner.favorite" {
+		return func(map[string]interface{}) (interface{}, error) { return &RequiredPet{}, nil }, nil
+	}
+	return nil, nil
+}
+
+// errorPaths returns the paths of the FieldErrors held by err
+func errorPaths(err error) []string {
+	paths := []string{}
+	errs, _ := err.(decode.Errors)
+	for _, e := range errs {
+		if fe, ok := e.(*decode.FieldError); ok {
+			paths = append(paths, fe.Path)
+		}
+	}
+	return paths
+}
+
+func TestRequired(t *testing.T) {
+	Convey("Every missing required property is reported with its path", t, func() {
+		b := `{ "pets": [ { "name": "rex", "age": 1, "type": "dog" }, { "age": 2 } ], "favorite": { "type": "cat" }, "home": {} }`
+		o, err := decode.UnmarshalJSONInto([]byte(b), &RequiredOwner{}, requiredSPF)
+		So(err, ShouldNotBeNil)
+		So(errorPaths(err), ShouldResemble, []string{
+			"favorite.name",
+			"favorite.age",
+			"home.rooms",
+			"pets[1].name",
+			"pets[1].type",
+			"name",
+		})
+		So(err.Error(), ShouldContainSubstring, "pets[1].name: missing required property")
+		// the rest of the payload is still decoded
+		So(o.(*RequiredOwner).Pets, ShouldHaveLength, 2)
+	})
+
+	Convey("Slice targets have no required properties to check", t, func() {
+		r, err := decode.DecodeInto(map[string]interface{}{}, &[]int{}, nil)
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, &[]int{})
+		_, err = decode.DecodeIntoWithDefaults(map[string]interface{}{"a": 1}, &[]int{}, nil, true)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payloads with every required property decode", t, func() {
+		b := `{ "name": "john", "favorite": { "type": "cat", "name": "tom", "age": 3 }, "home": { "rooms": 2 } }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &RequiredOwner{}, requiredSPF)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Required properties are reported even if they have a default", t, func() {
+		b := `{ "name": "john", "favorite": { "type": "cat", "name": "tom", "age": 3 }, "home": {} }`
+		o, err := decode.UnmarshalJSONIntoWithDefaults([]byte(b), &RequiredOwner{}, requiredSPF, true)
+		So(errorPaths(err), ShouldResemble, []string{"home.rooms"})
+		So(o.(*RequiredOwner).Home.Rooms, ShouldEqual, 1)
+	})
+
+	Convey("Type errors still stop decoding", t, func() {
+		b := `{ "pets": [ { "age": "old" } ] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &RequiredOwner{}, requiredSPF)
+		So(err, ShouldNotBeNil)
+		So(errorPaths(err), ShouldBeEmpty)
+	})
+
+	Convey("Registered properties belong to a single type", t, func() {
+		// same name as the package level type, but a different type
+		type RequiredPet struct {
+			Name *string `json:"name"`
+		}
+		So(decode.Validate([]byte(`{}`), &RequiredPet{}, nil), ShouldBeNil)
+
+		type Tagged struct {
+			Tag *string `json:"tag"`
+		}
+		decode.RegisterRequired(&Tagged{}, "tag")
+		decode.RegisterRequired(Tagged{}, "tag")
+		So(errorPaths(decode.Validate([]byte(`{}`), &Tagged{}, nil)), ShouldResemble, []string{"tag"})
+
+		decode.UnregisterRequired(Tagged{})
+		So(decode.Validate([]byte(`{}`), &Tagged{}, nil), ShouldBeNil)
+	})
+}
+
+type ConstrainedToy struct {
+	Name string `json:"name" minLength:"1"`
+}
+
+type ConstrainedPet struct {
+	Name   *string           `json:"name" minLength:"2" maxLength:"5" pattern:"^[a-z]+$"`
+	Age    int               `json:"age" minimum:"0" maximum:"30"`
+	Weight *float64          `json:"weight" minimum:"0.5"`
+	Kind   string            `json:"kind" enum:"cat,dog"`
+	Legs   *int              `json:"legs" enum:"2,4"`
+	Tags   []string          `json:"tags" minItems:"1" maxItems:"3" uniqueItems:"true"`
+	Toys   *[]ConstrainedToy `json:"toys" maxItems:"1"`
+	Size   int               `json:"size" default:"100" maximum:"10"`
+}
+
+type ConstrainedOwner struct {
+	Pets []ConstrainedPet `json:"pets"`
+}
+
+func TestConstraints(t *testing.T) {
+	Convey("Valid values pass, and missing fields are not checked", t, func() {
+		b := `{ "pets": [ { "name": "rex", "age": 3, "weight": 0.5, "kind": "dog", "legs": 4, "tags": ["a", "b"], "toys": [{ "name": "ball" }] }, {} ] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &ConstrainedOwner{}, nil)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Every broken constraint is reported with its path", t, func() {
+		b := `{ "pets": [ {}, { "name": "R2D2XX", "age": 31, "weight": 0.1, "kind": "bird", "legs": 3, "tags": ["a", "a", "b", "c"], "toys": [{ "name": "" }, { "name": "ball" }] } ] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &ConstrainedOwner{}, nil)
+		So(err, ShouldNotBeNil)
+		So(errorPaths(err), ShouldResemble, []string{
+			"pets[1].toys[0].name",
+			"pets[1].name",
+			"pets[1].name",
+			"pets[1].age",
+			"pets[1].weight",
+			"pets[1].kind",
+			"pets[1].legs",
+			"pets[1].tags",
+			"pets[1].tags",
+			"pets[1].toys",
+		})
+		So(err.Error(), ShouldContainSubstring, "pets[1].age: value 31 breaks maximum 30")
+		So(err.Error(), ShouldContainSubstring, "pets[1].kind: value 'bird' is not one of enum cat,dog")
+		So(err.Error(), ShouldContainSubstring, "pets[1].tags: items 0 and 1 are equal, breaking uniqueItems")
+	})
+
+	Convey("Defaults are checked against constraints", t, func() {
+		_, err := decode.UnmarshalJSONIntoWithDefaults([]byte(`{ "pets": [ {} ] }`), &ConstrainedOwner{}, nil, true)
+		So(errorPaths(err), ShouldResemble, []string{"pets[0].size"})
+	})
+
+	Convey("Invalid constraint tags are reported", t, func() {
+		type BadTags struct {
+			Age     int      `minimum:"a"`
+			Name    string   `pattern:"(" maxLength:"x"`
+			Tags    []string `uniqueItems:"maybe" minItems:"-"`
+			Ignored bool     `minLength:"2" minimum:"3"`
+		}
+		b := `{ "age": 1, "name": "x", "tags": [], "ignored": true }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &BadTags{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"age", "name", "name", "tags", "tags"})
+	})
+}
+
+type ValidatedPalace struct {
+	Halls  int `json:"halls"`
+	Towers int `json:"towers"`
+}
+
+// Validate checks that a Palace has at least as many Halls as Towers
+func (p ValidatedPalace) Validate() error {
+	if p.Halls < p.Towers {
+		return errors.New("Palace must have Halls >= Towers")
+	}
+	return nil
+}
+
+type ValidatedKingdom struct {
+	Name    string            `json:"name"`
+	Capital interface{}       `json:"capital"`
+	Palaces []ValidatedPalace `json:"palaces"`
+}
+
+// Validate checks that a Kingdom has a Capital and a Name, reporting the paths of the missing properties
+func (k *ValidatedKingdom) Validate() error {
+	var errs decode.Errors
+	if k.Capital == nil {
+		errs = append(errs, &decode.FieldError{Path: "capital", Err: errors.New("a kingdom needs a capital")})
+	}
+	if k.Name == "" {
+		errs = append(errs, &decode.FieldError{Path: "name", Err: errors.New("a kingdom needs a name")})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+var validatedSPF = func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+	if path == "ValidatedKingdom.capital" {
+		return func(map[string]interface{}) (interface{}, error) { return &ValidatedPalace{}, nil }, nil
+	}
+	return nil, nil
+}
+
+func TestValidator(t *testing.T) {
+	Convey("Validate is called on every decoded object, children first", t, func() {
+		b := `{ "capital": { "halls": 1, "towers": 2 }, "palaces": [ { "halls": 2, "towers": 1 }, { "towers": 1 } ] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &ValidatedKingdom{}, validatedSPF)
+		So(errorPaths(err), ShouldResemble, []string{"capital", "palaces[1]", "name"})
+		So(err.Error(), ShouldEqual, "capital: Palace must have Halls >= Towers; palaces[1]: Palace must have Halls >= Towers; name: a kingdom needs a name")
+	})
+
+	Convey("Valid objects pass", t, func() {
+		b := `{ "name": "Mysore", "capital": { "halls": 2, "towers": 2 }, "palaces": [ { "halls": 2, "towers": 1 } ] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &ValidatedKingdom{}, validatedSPF)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Root errors have no path", t, func() {
+		_, err := decode.UnmarshalJSONInto([]byte(`{ "towers": 1 }`), &ValidatedPalace{}, nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Palace must have Halls >= Towers")
+	})
+}
+
+type RuledShack struct {
+	Type     *string `json:"type"`
+	Rooms    *int    `json:"rooms"`
+	Material *string `json:"material" required_if:"type=Shack rooms>1"`
+	Owner    string  `json:"owner" required_with:"tenant landlord"`
+	Tenant   string  `json:"tenant" excluded_with:"owner"`
+	Landlord string  `json:"landlord"`
+}
+
+// ruleTarget returns a new object whose Checked field is subject to the required_if rule
+func ruleTarget(rule string) interface{} {
+	t := reflect.StructOf([]reflect.StructField{
+		{Name: "Name", Type: reflect.TypeOf(""), Tag: `json:"name"`},
+		{Name: "Rooms", Type: reflect.TypeOf(0), Tag: `json:"rooms"`},
+		{Name: "Missing", Type: reflect.TypeOf((*int)(nil)), Tag: `json:"missing"`},
+		{Name: "Checked", Type: reflect.TypeOf((*int)(nil)), Tag: reflect.StructTag(`json:"checked" required_if:"` + rule + `"`)},
+	})
+	return reflect.New(t).Interface()
+}
+
+type RuledVillage struct {
+	Shacks []RuledShack `json:"shacks"`
+}
+
+func TestRules(t *testing.T) {
+	Convey("Conditional rules are checked against the decoded object", t, func() {
+		b := `{ "shacks": [
+			{ "type": "Shack", "rooms": 1 },
+			{ "type": "Shack", "rooms": 2 },
+			{ "type": "Hut", "rooms": 2 },
+			{ "type": "Shack", "rooms": 3, "material": "wood", "landlord": "ann" },
+			{ "owner": "bob", "tenant": "carl" },
+			{ "tenant": "dan" }
+		] }`
+		_, err := decode.UnmarshalJSONInto([]byte(b), &RuledVillage{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"shacks[1].material", "shacks[3].owner", "shacks[4].tenant", "shacks[5].owner"})
+		So(err.Error(), ShouldEqual, "shacks[1].material: required when type=Shack rooms>1; "+
+			"shacks[3].owner: required with landlord; shacks[4].tenant: not allowed with owner; "+
+			"shacks[5].owner: required with tenant")
+	})
+
+	Convey("Every comparison operator is supported", t, func() {
+		for _, tc := range []struct {
+			rule  string
+			fails bool
+		}{
+			{"rooms=2", true},
+			{"rooms!=2", false},
+			{"rooms>=2", true},
+			{"rooms<=1", false},
+			{"rooms<3", true},
+			{"rooms>2", false},
+			{"name>a", true},
+			{"name<a", false},
+			{"missing=1", false},
+		} {
+			m := map[string]interface{}{"name": "b", "rooms": 2}
+			_, err := decode.DecodeInto(m, ruleTarget(tc.rule), nil)
+			So(err != nil, ShouldEqual, tc.fails)
+		}
+	})
+
+	Convey("Invalid rules are reported", t, func() {
+		type BadRules struct {
+			A string `required_if:"x=1"`
+			B string `required_with:"x"`
+			C string `excluded_with:"x"`
+			D string `required_if:"rooms"`
+			E int    `required_if:"e>x"`
+		}
+		_, err := decode.DecodeInto(map[string]interface{}{"c": "x"}, &BadRules{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"a", "b", "c", "d", "e"})
+	})
+
+	Convey("Fields are set when their property is present, whatever its value", t, func() {
+		type Counted struct {
+			Name  string `json:"name"`
+			Count int    `json:"count" required_with:"name"`
+			Alias string `json:"alias" excluded_with:"name"`
+		}
+		err := decode.Validate([]byte(`{ "name": "x", "count": 0 }`), &Counted{}, nil)
+		So(err, ShouldBeNil)
+		err = decode.Validate([]byte(`{ "name": "x", "count": 1, "alias": "" }`), &Counted{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"alias"})
+		err = decode.Validate([]byte(`{ "name": "", "alias": "y" }`), &Counted{}, nil)
+		So(errorPaths(err), ShouldResemble, []string{"count", "alias"})
+	})
+}
+
+type AdmissionPet struct {
+	Name string `json:"name" required:"true"`
+	Age  int    `json:"age" maximum:"30"`
+	Legs int    `json:"legs" default:"four"`
+}
+
+type AdmissionRequest struct {
+	Owner    string         `json:"owner" required:"true"`
+	Pets     []AdmissionPet `json:"pets"`
+	Favorite interface{}    `json:"favorite"`
+}
+
+func TestValidate(t *testing.T) {
+	admissionSPF := func(path string) (func(map[string]interface{}) (interface{}, error), error) {
+		if path == "AdmissionRequest.favorite" {
+			return Accommodation_class_Factory, nil
+		}
+		return nil, nil
+	}
+
+	Convey("Validate accepts the targets DecodeInto does", t, func() {
+		So(decode.Validate([]byte(`{}`), &[]int{}, nil), ShouldBeNil)
+		So(decode.Validate([]byte(`{}`), 7, nil), ShouldNotBeNil)
+		So(decode.Validate([]byte(`{}`), nil, nil), ShouldNotBeNil)
+	})
+
+	Convey("Validate reports every problem of a payload", t, func() {
+		b := `{ "pets": [ { "name": "rex", "age": "old" }, { "age": 40 }, 7 ], "favorite": { "type": "car" } }`
+		target := &AdmissionRequest{}
+		err := decode.Validate([]byte(b), target, admissionSPF)
+		So(errorPaths(err), ShouldResemble, []string{
+			"favorite",
+			"pets[0].age",
+			"pets[0].legs",
+			"pets[1].name",
+			"pets[1].legs",
+			"pets[1].age",
+			"pets[2]",
+			"owner",
+		})
+		So(target, ShouldResemble, &AdmissionRequest{})
+
+		// decoding stops at the first of them
+		_, err = decode.UnmarshalJSONInto([]byte(b), &AdmissionRequest{}, admissionSPF)
+		So(errorPaths(err), ShouldBeEmpty)
+	})
+
+	Convey("Validate accepts valid payloads and value targets", t, func() {
+		b := `{ "owner": "john", "pets": [ { "name": "rex", "age": 3, "legs": 4 } ], "favorite": { "type": "House" } }`
+		So(decode.Validate([]byte(b), AdmissionRequest{}, admissionSPF), ShouldBeNil)
+	})
+
+	Convey("Validate fails on bad JSON and bad targets", t, func() {
+		So(decode.Validate([]byte(`{ "owner": `), &AdmissionRequest{}, admissionSPF), ShouldNotBeNil)
+		So(decode.Validate([]byte(`{}`), nil, admissionSPF), ShouldNotBeNil)
+		So(decode.Validate([]byte(`{}`), 1, admissionSPF), ShouldNotBeNil)
+	})
+}